@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/apis/jakub-bacic/v1alpha1"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/stub"
+	"github.com/operator-framework/operator-sdk/pkg/util/k8sutil"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// operatorConfig defines settings of the operator. They're read from the config file, environment variables and
+// command-line flags (in order of increasing precedence).
+type operatorConfig struct {
+	// Watched namespaces (all namespaces are watched if empty)
+	Namespaces []string `json:"namespaces"`
+	// Resync period of Database and DatabaseServer resources
+	ResyncPeriod metav1.Duration `json:"resyncPeriod"`
+	// Number of workers handling events of each watched resource
+	Workers int `json:"workers"`
+	// Maximum number of concurrent operations (and open connections) per database server (0 means no limit)
+	MaxServerConnections int `json:"maxServerConnections"`
+	// Upper limit of the delay between retries of the failed resources
+	MaxRetryBackoff metav1.Duration `json:"maxRetryBackoff"`
+	// Default deletion policy (used if neither deletionPolicy nor dropOnDelete is set in Database spec)
+	DeletionPolicy string `json:"deletionPolicy"`
+	// Deprecated: use deletionPolicy (true is the same as Delete, false as Retain)
+	DropOnDelete *bool `json:"dropOnDelete,omitempty"`
+	// Log level (debug, info, warning or error)
+	LogLevel string `json:"logLevel"`
+	// Log format (text or json)
+	LogFormat string `json:"logFormat"`
+	// Address of the HTTP server exposing metrics and health probes
+	MetricsAddress string `json:"metricsAddress"`
+	// Enabled database server types (all types are enabled if empty)
+	Engines []string `json:"engines"`
+	// ID of the operator instance stored in ownership markers on the database servers (UID of kube-system
+	// namespace if empty, so operators in different clusters sharing the database server never collect each
+	// other's objects)
+	InstanceID           string `json:"instanceID"`
+	LeaderElection       bool   `json:"leaderElection"`
+	ServerReadinessCheck bool   `json:"serverReadinessCheck"`
+}
+
+func defaultConfig() *operatorConfig {
+	return &operatorConfig{
+		ResyncPeriod:         metav1.Duration{Duration: 10 * time.Second},
+		Workers:              4,
+		MaxServerConnections: 5,
+		MaxRetryBackoff:      metav1.Duration{Duration: stub.DefaultMaxRetryBackoff},
+		DeletionPolicy:       v1alpha1.DeletionPolicyDelete,
+		LogLevel:             "info",
+		LogFormat:            "text",
+		MetricsAddress:       fmt.Sprintf(":%d", k8sutil.PrometheusMetricsPort),
+		LeaderElection:       true,
+	}
+}
+
+// loadConfig returns settings of the operator read from the config file (--config), environment variables and
+// the given command-line arguments
+func loadConfig(args []string) (*operatorConfig, error) {
+	// config file is read first, so the flags parsed afterwards override its settings
+	var configFile string
+	if err := newFlagSet(defaultConfig(), &configFile).Parse(args); err != nil {
+		return nil, err
+	}
+
+	config := defaultConfig()
+	if configFile != "" {
+		if err := config.readFile(configFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.readEnv(); err != nil {
+		return nil, err
+	}
+	if err := newFlagSet(config, &configFile).Parse(args); err != nil {
+		return nil, err
+	}
+
+	config.Namespaces = uniqueNamespaces(config.Namespaces)
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func newFlagSet(config *operatorConfig, configFile *string) *pflag.FlagSet {
+	flags := pflag.NewFlagSet(os.Args[0], pflag.ExitOnError)
+	flags.StringVar(configFile, "config", "", "Path to the YAML config file (flags override its settings)")
+	flags.StringSliceVar(&config.Namespaces, "namespaces", config.Namespaces,
+		"Comma-separated list of watched namespaces (all namespaces are watched if empty)")
+	flags.DurationVar(&config.ResyncPeriod.Duration, "resync-period", config.ResyncPeriod.Duration,
+		"Resync period of Database and DatabaseServer resources")
+	flags.IntVar(&config.Workers, "workers", config.Workers, "Number of workers handling events of each watched resource")
+	flags.IntVar(&config.MaxServerConnections, "max-server-connections", config.MaxServerConnections,
+		"Maximum number of concurrent operations (and open connections) per database server (0 means no limit)")
+	flags.DurationVar(&config.MaxRetryBackoff.Duration, "max-retry-backoff", config.MaxRetryBackoff.Duration,
+		"Upper limit of the delay between retries of the failed resources")
+	flags.StringVar(&config.DeletionPolicy, "deletion-policy", config.DeletionPolicy,
+		"Default deletion policy of Database resources (Delete, Retain, RetainData or Snapshot)")
+	flags.Var(&dropOnDeleteValue{config}, "drop-on-delete", "Default of dropOnDelete option")
+	flags.Lookup("drop-on-delete").NoOptDefVal = "true"
+	flags.MarkDeprecated("drop-on-delete", "use --deletion-policy instead")
+	flags.StringVar(&config.LogLevel, "log-level", config.LogLevel, "Log level (debug, info, warning, error)")
+	flags.StringVar(&config.LogFormat, "log-format", config.LogFormat, "Log format (text or json)")
+	flags.StringVar(&config.MetricsAddress, "metrics-address", config.MetricsAddress,
+		"Address of the HTTP server exposing metrics and health probes")
+	flags.StringSliceVar(&config.Engines, "engines", config.Engines,
+		"Comma-separated list of enabled database server types (all types are enabled if empty)")
+	flags.StringVar(&config.InstanceID, "instance-id", config.InstanceID,
+		"ID of the operator instance stored in ownership markers (UID of kube-system namespace if empty)")
+	flags.BoolVar(&config.LeaderElection, "leader-election", config.LeaderElection,
+		"Elect the leader among operator replicas (only the leader handles resources)")
+	flags.BoolVar(&config.ServerReadinessCheck, "server-readiness-check", config.ServerReadinessCheck,
+		"Report the operator as ready only when all DatabaseServer resources are reachable")
+	return flags
+}
+
+// readFile reads settings from the YAML config file (settings missing in the file are not changed)
+func (config *operatorConfig) readFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	deletionPolicy := config.DeletionPolicy
+	config.DeletionPolicy = ""
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("failed to parse config file %v: %v", path, err)
+	}
+	// deprecated dropOnDelete is used only if deletionPolicy is not set
+	if config.DeletionPolicy == "" && config.DropOnDelete != nil {
+		config.DeletionPolicy = deletionPolicyFromDropOnDelete(*config.DropOnDelete)
+	} else if config.DeletionPolicy == "" {
+		config.DeletionPolicy = deletionPolicy
+	}
+	config.DropOnDelete = nil
+	return nil
+}
+
+// readEnv reads settings from the environment variables (kept for compatibility with existing deployments)
+func (config *operatorConfig) readEnv() error {
+	if value, ok := os.LookupEnv(k8sutil.WatchNamespaceEnvVar); ok {
+		config.Namespaces = strings.Split(value, ",")
+	}
+	if value, ok := os.LookupEnv(maxRetryBackoffEnvVar); ok {
+		maxRetryBackoff, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid %v: %v", maxRetryBackoffEnvVar, value)
+		}
+		config.MaxRetryBackoff.Duration = maxRetryBackoff
+	}
+	if value, ok := os.LookupEnv(leaderElectionEnvVar); ok {
+		leaderElection, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %v: %v", leaderElectionEnvVar, value)
+		}
+		config.LeaderElection = leaderElection
+	}
+	if value, ok := os.LookupEnv(serverReadinessCheckEnvVar); ok {
+		serverReadinessCheck, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %v: %v", serverReadinessCheckEnvVar, value)
+		}
+		config.ServerReadinessCheck = serverReadinessCheck
+	}
+	return nil
+}
+
+func (config *operatorConfig) validate() error {
+	if config.ResyncPeriod.Duration < 0 {
+		return fmt.Errorf("invalid resync period: %v", config.ResyncPeriod.Duration)
+	}
+	if config.Workers < 1 {
+		return fmt.Errorf("invalid number of workers: %v", config.Workers)
+	}
+	if config.MaxServerConnections < 0 {
+		return fmt.Errorf("invalid max server connections: %v", config.MaxServerConnections)
+	}
+	if config.MaxRetryBackoff.Duration <= 0 {
+		return fmt.Errorf("invalid max retry backoff: %v", config.MaxRetryBackoff.Duration)
+	}
+	switch config.DeletionPolicy {
+	case v1alpha1.DeletionPolicyDelete, v1alpha1.DeletionPolicyRetain, v1alpha1.DeletionPolicyRetainData:
+	case v1alpha1.DeletionPolicySnapshot:
+		// snapshot target is configured per resource
+		return fmt.Errorf("%v can't be the default deletion policy", config.DeletionPolicy)
+	default:
+		return fmt.Errorf("unsupported deletion policy: %v", config.DeletionPolicy)
+	}
+	if strings.ContainsAny(config.InstanceID, ":/") {
+		return fmt.Errorf("invalid instance ID: %v (it can't contain colons or slashes)", config.InstanceID)
+	}
+	for _, engine := range config.Engines {
+		if engine != v1alpha1.DatabaseServerTypeMySQL && engine != v1alpha1.DatabaseServerTypePostgreSQL {
+			return fmt.Errorf("unsupported database server type: %v", engine)
+		}
+	}
+	return nil
+}
+
+// uniqueNamespaces returns trimmed, unique namespaces (or all namespaces if none is given)
+func uniqueNamespaces(values []string) []string {
+	var namespaces []string
+	watched := map[string]bool{}
+	for _, namespace := range values {
+		namespace = strings.TrimSpace(namespace)
+		if namespace != "" && !watched[namespace] {
+			watched[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	if len(namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return namespaces
+}
+
+// dropOnDeleteValue is the value of deprecated --drop-on-delete flag setting the default deletion policy
+type dropOnDeleteValue struct {
+	config *operatorConfig
+}
+
+func (v *dropOnDeleteValue) Set(value string) error {
+	dropOnDelete, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	v.config.DeletionPolicy = deletionPolicyFromDropOnDelete(dropOnDelete)
+	return nil
+}
+
+func (v *dropOnDeleteValue) String() string {
+	return strconv.FormatBool(v.config.DeletionPolicy == v1alpha1.DeletionPolicyDelete)
+}
+
+func (v *dropOnDeleteValue) Type() string {
+	return "bool"
+}
+
+func deletionPolicyFromDropOnDelete(dropOnDelete bool) string {
+	if dropOnDelete {
+		return v1alpha1.DeletionPolicyDelete
+	}
+	return v1alpha1.DeletionPolicyRetain
+}
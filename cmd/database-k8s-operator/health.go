@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jakub-bacic/database-k8s-operator/pkg/apis/jakub-bacic/v1alpha1"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/logging"
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// maxEventHandlingDuration limits how long a single event may be handled before the operator is considered stuck
+// (e.g. waiting on an unresponsive database server connection)
+const maxEventHandlingDuration = 10 * time.Minute
+
+var (
+	// watchesStarted is set to 1 once the watches are started (standby replicas don't start them)
+	watchesStarted int32
+	// watchesSynced is set to 1 once caches of all watched resources are synced
+	watchesSynced int32
+)
+
+// watchedResource identifies the resource watched with sdk.Watch
+type watchedResource struct {
+	apiVersion string
+	kind       string
+	namespace  string
+}
+
+// watchedResources lists resources registered with watchResource
+var watchedResources []watchedResource
+
+// watchResource watches the resource with sdk.Watch and registers it for the readiness check
+func watchResource(apiVersion, kind, namespace string, resyncPeriod time.Duration, workers int) {
+	sdk.Watch(apiVersion, kind, namespace, resyncPeriod, sdk.WithNumWorkers(workers))
+	watchedResources = append(watchedResources, watchedResource{apiVersion: apiVersion, kind: kind, namespace: namespace})
+}
+
+// runWatches starts the watches and blocks until the context is cancelled
+func runWatches(ctx context.Context) {
+	atomic.StoreInt32(&watchesStarted, 1)
+	go waitForWatchesSync(ctx)
+	sdk.Run(ctx)
+}
+
+// waitForWatchesSync sets watchesSynced once caches of all watched resources are synced. Informers of the SDK are
+// not exposed, so the same resources are synced by separate informers (stopped right after the sync); the SDK
+// doesn't handle any event before its informers are synced as well.
+func waitForWatchesSync(ctx context.Context) {
+	logger := logging.GetLogger(ctx)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	var synced []cache.InformerSynced
+	for _, resource := range watchedResources {
+		client, _, err := k8sclient.GetResourceClient(resource.apiVersion, resource.kind, resource.namespace)
+		if err != nil {
+			logger.Errorf("failed to get resource client for %v %v: %v", resource.kind, resource.namespace, err)
+			return
+		}
+		informer := cache.NewSharedIndexInformer(&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return client.Watch(options)
+			},
+		}, &unstructured.Unstructured{}, 0, cache.Indexers{})
+		go informer.Run(stop)
+		synced = append(synced, informer.HasSynced)
+	}
+
+	if cache.WaitForCacheSync(ctx.Done(), synced...) {
+		logger.Infof("Watches synced")
+		atomic.StoreInt32(&watchesSynced, 1)
+	}
+}
+
+// watchesSyncedCheck checks if caches of the watched resources are synced. Standby replicas are always ready.
+func watchesSyncedCheck() error {
+	if atomic.LoadInt32(&watchesStarted) == 1 && atomic.LoadInt32(&watchesSynced) == 0 {
+		return fmt.Errorf("watches not synced yet")
+	}
+	return nil
+}
+
+// serversReachableCheck checks if all DatabaseServer resources are reachable (according to their status)
+func serversReachableCheck() error {
+	servers := &v1alpha1.DatabaseServerList{
+		TypeMeta: metav1.TypeMeta{Kind: "DatabaseServer", APIVersion: v1alpha1.SchemeGroupVersion.String()},
+	}
+	if err := sdk.List("", servers); err != nil {
+		return fmt.Errorf("failed to list database servers: %v", err)
+	}
+
+	var unreachable []string
+	for _, server := range servers.Items {
+		if !server.Status.Reachable {
+			unreachable = append(unreachable, server.Name)
+		}
+	}
+	if len(unreachable) > 0 {
+		return fmt.Errorf("database servers not reachable: %v", strings.Join(unreachable, ", "))
+	}
+	return nil
+}
+
+// trackedHandler records events being handled, so the liveness check can detect stuck workers
+type trackedHandler struct {
+	handler sdk.Handler
+
+	mutex    sync.Mutex
+	next     int64
+	inFlight map[int64]time.Time
+}
+
+func newTrackedHandler(handler sdk.Handler) *trackedHandler {
+	return &trackedHandler{handler: handler, inFlight: map[int64]time.Time{}}
+}
+
+func (h *trackedHandler) Handle(ctx context.Context, event sdk.Event) error {
+	h.mutex.Lock()
+	id := h.next
+	h.next++
+	h.inFlight[id] = time.Now()
+	h.mutex.Unlock()
+
+	defer func() {
+		h.mutex.Lock()
+		delete(h.inFlight, id)
+		h.mutex.Unlock()
+	}()
+	return h.handler.Handle(ctx, event)
+}
+
+// stuckCheck fails if any event has been handled for longer than maxEventHandlingDuration
+func (h *trackedHandler) stuckCheck() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var oldest time.Duration
+	for _, started := range h.inFlight {
+		if duration := time.Since(started); duration > oldest {
+			oldest = duration
+		}
+	}
+	if oldest > maxEventHandlingDuration {
+		return fmt.Errorf("event handled for %v", oldest.Round(time.Second))
+	}
+	return nil
+}
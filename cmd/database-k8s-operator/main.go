@@ -2,8 +2,16 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"os"
 	"runtime"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/health"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/leader"
 	"github.com/jakub-bacic/database-k8s-operator/pkg/logging"
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/apis/jakub-bacic/v1alpha1"
 	"github.com/operator-framework/operator-sdk/pkg/util/k8sutil"
 	sdkVersion "github.com/operator-framework/operator-sdk/version"
 
@@ -11,6 +19,27 @@ import (
 	"github.com/operator-framework/operator-sdk/pkg/sdk"
 	"github.com/jakub-bacic/database-k8s-operator/pkg/stub"
 	"time"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	databaseKind       = "Database"
+	databaseServerKind = "DatabaseServer"
+)
+
+// Environment variables overriding the config file (flags take precedence over them)
+const (
+	// maxRetryBackoffEnvVar is the environment variable with upper limit of the delay between retries (e.g. 10m)
+	maxRetryBackoffEnvVar = "MAX_RETRY_BACKOFF"
+	// leaderElectionEnvVar is the environment variable disabling leader election (if set to false)
+	leaderElectionEnvVar = "LEADER_ELECTION"
+	// podNameEnvVar and podNamespaceEnvVar are the environment variables with name and namespace of the operator pod
+	podNameEnvVar      = "POD_NAME"
+	podNamespaceEnvVar = "POD_NAMESPACE"
+	// serverReadinessCheckEnvVar is the environment variable enabling readiness check of database servers (if set to
+	// true, the operator is ready only when all DatabaseServer resources are reachable)
+	serverReadinessCheckEnvVar = "SERVER_READINESS_CHECK"
 )
 
 func printVersion(ctx context.Context) {
@@ -23,17 +52,122 @@ func printVersion(ctx context.Context) {
 func main() {
 	ctx := logging.NewContext(context.TODO(), logging.Fields{})
 	logger := logging.GetLogger(ctx)
+
+	config, err := loadConfig(os.Args[1:])
+	if err != nil {
+		logger.Fatalf("invalid configuration: %v", err)
+	}
+	if err := logging.Configure(config.LogLevel, config.LogFormat); err != nil {
+		logger.Fatalf("invalid configuration: %v", err)
+	}
 	printVersion(ctx)
 
-	resource := "jakub-bacic.github.com/v1alpha1"
-	kind := "Database"
-	namespace, err := k8sutil.GetWatchNamespace()
+	instanceID, err := getInstanceID(config.InstanceID)
+	if err != nil {
+		logger.Fatalf("failed to get instance ID: %v", err)
+	}
+	logger.Infof("Operator instance ID: %v", instanceID)
+
+	resource := v1alpha1.SchemeGroupVersion.String()
+	resyncPeriod := config.ResyncPeriod.Duration
+	for _, namespace := range config.Namespaces {
+		logger.Infof("Watching %s, %s, %s, %v", resource, databaseKind, namespace, resyncPeriod)
+		watchResource(resource, databaseKind, namespace, resyncPeriod, config.Workers)
+		// Secrets are watched to apply their changes right away (resync is not needed, Databases are resynced anyway)
+		logger.Infof("Watching %s, %s, %s, %d", "v1", "Secret", namespace, 0)
+		watchResource("v1", "Secret", namespace, 0, config.Workers)
+	}
+	// DatabaseServer is cluster-scoped
+	logger.Infof("Watching %s, %s, %s, %v", resource, databaseServerKind, "", resyncPeriod)
+	watchResource(resource, databaseServerKind, "", resyncPeriod, config.Workers)
+	handler := newTrackedHandler(stub.NewHandler(stub.Config{
+		MaxRetryBackoff:      config.MaxRetryBackoff.Duration,
+		DeletionPolicy:       config.DeletionPolicy,
+		Engines:              config.Engines,
+		MaxServerConnections: config.MaxServerConnections,
+		Namespaces:           config.Namespaces,
+		InstanceID:           instanceID,
+	}))
+	sdk.Handle(handler)
+
+	liveness := health.NewChecker()
+	liveness.AddCheck("handler", handler.stuckCheck)
+	readiness := health.NewChecker()
+	readiness.AddCheck("watches", watchesSyncedCheck)
+	if config.ServerReadinessCheck {
+		readiness.AddCheck("servers", serversReachableCheck)
+	}
+	// metrics and probes are served by all replicas (not only by the leader)
+	go serveHTTP(ctx, config.MetricsAddress, liveness, readiness)
+
+	if !config.LeaderElection {
+		runWatches(ctx)
+		return
+	}
+	elector, err := newLeaderElector(config.Namespaces[0])
+	if err != nil {
+		logger.Fatalf("failed to initialize leader election: %v", err)
+	}
+	// watches are started only by the leader, so resources are never handled by two replicas at once
+	elector.Run(ctx, runWatches, func() {
+		logger.Fatalf("leadership lost, exiting")
+	})
+}
+
+// serveHTTP exposes Prometheus metrics (/metrics), liveness (/healthz) and readiness (/readyz) probes on the given
+// address (the standard operator-sdk metrics port 60000 by default)
+func serveHTTP(ctx context.Context, address string, liveness *health.Checker, readiness *health.Checker) {
+	logger := logging.GetLogger(ctx)
+	http.Handle("/"+k8sutil.PrometheusMetricsPortName, promhttp.Handler())
+	http.Handle("/healthz", liveness)
+	http.Handle("/readyz", readiness)
+	logger.Infof("Serving metrics and health probes on %v", address)
+	if err := http.ListenAndServe(address, nil); err != nil {
+		logger.Fatalf("failed to serve metrics and health probes: %v", err)
+	}
+}
+
+// getInstanceID returns the configured instance ID or UID of kube-system namespace (it identifies the cluster)
+func getInstanceID(configured string) (string, error) {
+	if configured != "" {
+		return configured, nil
+	}
+	namespace := &v1.Namespace{
+		TypeMeta:   metav1.TypeMeta{Kind: "Namespace", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: metav1.NamespaceSystem},
+	}
+	if err := sdk.Get(namespace); err != nil {
+		return "", fmt.Errorf("failed to get namespace %v: %v", metav1.NamespaceSystem, err)
+	}
+	return string(namespace.UID), nil
+}
+
+// newLeaderElector returns the elector using ConfigMap lock in the operator namespace (or the first watched
+// namespace when running outside of the cluster)
+func newLeaderElector(watchNamespace string) (*leader.Elector, error) {
+	operatorName, err := k8sutil.GetOperatorName()
 	if err != nil {
-		logger.Fatalf("failed to get watch namespace: %v", err)
+		return nil, err
+	}
+
+	lockNamespace := os.Getenv(podNamespaceEnvVar)
+	if lockNamespace == "" {
+		lockNamespace = watchNamespace
+	}
+
+	identity := os.Getenv(podNameEnvVar)
+	if identity == "" {
+		if identity, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("failed to get hostname: %v", err)
+		}
 	}
-	resyncPeriod := time.Duration(10) * time.Second
-	logger.Infof("Watching %s, %s, %s, %d", resource, kind, namespace, 0)
-	sdk.Watch(resource, kind, namespace, resyncPeriod)
-	sdk.Handle(stub.NewHandler())
-	sdk.Run(ctx)
+
+	return leader.NewElector(leader.Config{
+		Namespace:     lockNamespace,
+		Name:          operatorName + "-lock",
+		Identity:      identity,
+		LeaseDuration: 15 * time.Second,
+		RenewDeadline: 10 * time.Second,
+		RetryPeriod:   2 * time.Second,
+	}, k8sclient.GetKubeClient())
 }
@@ -30,3 +30,53 @@ Create chart name and version as used by the chart label.
 {{- define "database-k8s-operator.chart" -}}
 {{- printf "%s-%s" .Chart.Name .Chart.Version | replace "+" "_" | trunc 63 | trimSuffix "-" -}}
 {{- end -}}
+
+{{/*
+Common labels of the chart resources.
+*/}}
+{{- define "database-k8s-operator.labels" }}
+    app: {{ template "database-k8s-operator.name" . }}
+    chart: {{ template "database-k8s-operator.chart" . }}
+    release: {{ .Release.Name }}
+    heritage: {{ .Release.Service }}
+{{- end }}
+
+{{/*
+RBAC rules required in each watched namespace.
+*/}}
+{{- define "database-k8s-operator.namespacedRules" }}
+- apiGroups:
+    - jakub-bacic.github.com
+  resources:
+    - "databases"
+    - "databases/status"
+  verbs:
+    - "*"
+- apiGroups:
+    - ""
+  resources:
+    - secrets
+  verbs:
+    - "get"
+    - "list"
+    - "watch"
+    - "create"
+    - "update"
+    - "delete"
+- apiGroups:
+    - ""
+  resources:
+    - events
+  verbs:
+    - "create"
+    - "update"
+# snapshots taken before the database is deleted
+- apiGroups:
+    - batch
+  resources:
+    - jobs
+  verbs:
+    - "get"
+    - "create"
+    - "delete"
+{{- end }}
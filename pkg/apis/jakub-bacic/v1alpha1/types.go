@@ -1,9 +1,16 @@
 package v1alpha1
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/jakub-bacic/database-k8s-operator/pkg/database"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -14,7 +21,53 @@ const (
 	StatusDeleting = "Deleting"
 	StatusError    = "Error"
 
-	FinalizerDeleteDb = "delete-db"
+	ReasonCreateFailed         = "CreateFailed"
+	ReasonDeleteFailed         = "DeleteFailed"
+	ReasonInvalidSpec          = "InvalidSpec"
+	ReasonPasswordUpdateFailed = "PasswordUpdateFailed"
+	ReasonRotationFailed       = "RotationFailed"
+	ReasonDriftReconcileFailed = "DriftReconcileFailed"
+	ReasonUpdateFailed         = "UpdateFailed"
+	ReasonSnapshotFailed       = "SnapshotFailed"
+	ReasonAlreadyExists        = "AlreadyExists"
+	ReasonOutputSecretFailed   = "OutputSecretFailed"
+
+	ConditionReady           = "Ready"
+	ConditionServerReachable = "ServerReachable"
+	ConditionUserProvisioned = "UserProvisioned"
+	ConditionSecretsResolved = "SecretsResolved"
+	ConditionDrifted         = "Drifted"
+	ConditionDeletionBlocked = "DeletionBlocked"
+
+	// AnnotationDeletionProtection enables deletion protection of the resource (if set to "true")
+	AnnotationDeletionProtection = "jakub-bacic.github.com/deletion-protection"
+
+	FinalizerDeleteDb = "jakub-bacic.github.com/delete-db"
+	// LegacyFinalizerDeleteDb is the finalizer used by the previous versions (it's replaced by FinalizerDeleteDb)
+	LegacyFinalizerDeleteDb = "delete-db"
+
+	defaultRotationGracePeriod = time.Hour
+
+	ownershipMarkerPrefix = "database-k8s-operator:"
+
+	DatabaseServerTypeMySQL      = "mysql"
+	DatabaseServerTypePostgreSQL = "postgresql"
+
+	// DeletionPolicyDelete drops the database and its users when Database resource is deleted
+	DeletionPolicyDelete = "Delete"
+	// DeletionPolicyRetain keeps the database and its users
+	DeletionPolicyRetain = "Retain"
+	// DeletionPolicyRetainData drops only the users (nobody can log in, but the data is kept)
+	DeletionPolicyRetainData = "RetainData"
+	// DeletionPolicySnapshot dumps the database to the volume and then drops the database and its users
+	DeletionPolicySnapshot = "Snapshot"
+
+	// AdoptionPolicyFail fails if the database or user already exists and is not managed by the resource
+	AdoptionPolicyFail = "Fail"
+	// AdoptionPolicyAdopt takes over the existing database and users (the deletion policy applies to them)
+	AdoptionPolicyAdopt = "Adopt"
+	// AdoptionPolicyAdoptAndRetain takes over the existing database and users, but never drops them
+	AdoptionPolicyAdoptAndRetain = "AdoptAndRetain"
 )
 
 // ObjectRef defines a reference to other k8s resource.
@@ -31,6 +84,16 @@ type SecretRef struct {
 	Key string `json:"key"`
 }
 
+// NamespacedSecretRef defines a reference to Secret key in the given namespace (used by cluster-scoped resources).
+type NamespacedSecretRef struct {
+	// Secret namespace
+	Namespace string `json:"namespace"`
+	// Secret name
+	Name string `json:"name"`
+	// Secret key
+	Key string `json:"key"`
+}
+
 // DatabaseList defines a list of Databases.
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 type DatabaseList struct {
@@ -63,8 +126,14 @@ type Database struct {
 type DatabaseSpec struct {
 	// Database desired configuration.
 	Database DatabaseObject `json:"database"`
-	// Database server configuration.
-	DatabaseServer DatabaseServerObject `json:"databaseServer"`
+	// Database server configuration (either databaseServer or databaseServerRef must be set).
+	DatabaseServer *DatabaseServerObject `json:"databaseServer,omitempty"`
+	// Reference to the DatabaseServer resource (either databaseServer or databaseServerRef must be set).
+	DatabaseServerRef *ObjectRef `json:"databaseServerRef,omitempty"`
+	// Secret to be created with the database connection details.
+	OutputSecret *OutputSecretObject `json:"outputSecret,omitempty"`
+	// Automatic credentials rotation policy.
+	Rotation *RotationObject `json:"rotation,omitempty"`
 	// Additional options.
 	Options *OptionsObject `json:"options,omitempty"`
 }
@@ -76,6 +145,75 @@ type DatabaseStatus struct {
 	Status string `json:"status"`
 	// Stores last error timestamp
 	LastErrorTimestamp *int64 `json:"lastErrorTimestamp,omitempty"`
+	// Short, machine readable reason of the last error (e.g. InvalidDatabaseName).
+	Reason string `json:"reason,omitempty"`
+	// Human readable description of the last error.
+	Message string `json:"message,omitempty"`
+	// Number of consecutive failures (reset once the database is created).
+	RetryCount int32 `json:"retryCount,omitempty"`
+	// Stores timestamp of the next retry after the error
+	NextRetryTimestamp *int64 `json:"nextRetryTimestamp,omitempty"`
+	// Hash of the spec which failed permanently (it's retried only after the spec changes).
+	FailedSpecHash string `json:"failedSpecHash,omitempty"`
+	// Salted hash of the current password of the database user (used to detect password changes).
+	PasswordHash string `json:"passwordHash,omitempty"`
+	// Stores timestamp of the last password change
+	PasswordUpdateTimestamp *int64 `json:"passwordUpdateTimestamp,omitempty"`
+	// Status of the credentials rotation (set only if rotation is enabled).
+	Rotation *RotationStatus `json:"rotation,omitempty"`
+	// Current conditions of the resource (e.g. Ready).
+	Conditions []Condition `json:"conditions,omitempty"`
+	// Generation of the spec applied on the database server.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Part of the spec applied on the database server (used to detect spec changes).
+	AppliedSpec *AppliedSpec `json:"appliedSpec,omitempty"`
+	// Whether the database or user existed before and has been adopted (see adoptionPolicy).
+	Adopted bool `json:"adopted,omitempty"`
+	// Name of the output Secret written by the operator (used to remove it when outputSecret name changes).
+	OutputSecretName string `json:"outputSecretName,omitempty"`
+	// Objects being created by the resource which haven't been marked as managed by it yet (they're not considered
+	// foreign when the creation is retried).
+	PendingObjects []PendingObject `json:"pendingObjects,omitempty"`
+}
+
+// AppliedSpec stores the spec fields which determine objects created on the database server.
+type AppliedSpec struct {
+	// Name of the database.
+	DatabaseName string `json:"databaseName"`
+	// Name of the database user.
+	User string `json:"user"`
+	// Identifier of the database server (see DatabaseServerID).
+	DatabaseServer string `json:"databaseServer"`
+	// Whether credentials rotation is enabled.
+	Rotation bool `json:"rotation,omitempty"`
+}
+
+// Condition describes one aspect of the resource state.
+type Condition struct {
+	// Type of the condition (e.g. Ready).
+	Type string `json:"type"`
+	// Status of the condition (True, False or Unknown).
+	Status corev1.ConditionStatus `json:"status"`
+	// Time of the last status change.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+	// Short, machine readable reason of the last status change.
+	Reason string `json:"reason,omitempty"`
+	// Human readable description of the last status change.
+	Message string `json:"message,omitempty"`
+}
+
+// RotationStatus defines most recent observed status of the credentials rotation.
+type RotationStatus struct {
+	// User currently published in the output Secret.
+	ActiveUser string `json:"activeUser"`
+	// User replaced during the last rotation (it's dropped after the grace period).
+	PreviousUser string `json:"previousUser,omitempty"`
+	// Stores last rotation timestamp
+	LastRotationTimestamp int64 `json:"lastRotationTimestamp"`
+	// User being activated by the rotation in progress (it's not published in the output Secret yet).
+	PendingUser string `json:"pendingUser,omitempty"`
+	// Hash of the new password of the pending user.
+	PendingPasswordHash string `json:"pendingPasswordHash,omitempty"`
 }
 
 // DatabaseObject defines database instance desired configuration.
@@ -84,13 +222,17 @@ type DatabaseObject struct {
 	Name string `json:"name"`
 	// User to be created (it will be granted all priviliges to the managed database)
 	User string `json:"user"`
-	// Secret containing password for the database user
-	PasswordSecretRef SecretRef `json:"passwordSecretRef"`
+	// Secret containing password for the database user (if not set, random password is generated and stored
+	// in the output Secret).
+	PasswordSecretRef *SecretRef `json:"passwordSecretRef,omitempty"`
+	// Authentication plugin to be used for the user (mysql only: mysql_native_password or caching_sha2_password).
+	// Server default plugin is used if not set.
+	AuthPlugin string `json:"authPlugin,omitempty"`
 }
 
 // DatabaseServerObject defines database server configuration.
 type DatabaseServerObject struct {
-	// Database type (see docs for the list of currently supported database server types).
+	// Database type (currently supported database server types: mysql, postgresql).
 	Type string `json:"type"`
 	// Database server host.
 	Host string `json:"host"`
@@ -100,24 +242,156 @@ type DatabaseServerObject struct {
 	RootUser string `json:"rootUser"`
 	// Secret containing password for the user
 	RootPasswordSecretRef SecretRef `json:"rootPasswordSecretRef"`
+	// SSL mode of the connections (only supported by postgresql: disable (default), allow, prefer, require,
+	// verify-ca or verify-full).
+	SSLMode string `json:"sslMode,omitempty"`
+}
+
+// DatabaseServerList defines a list of DatabaseServers.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DatabaseServerList struct {
+	metav1.TypeMeta `json:",inline"`
+	// Standard list metadata. More info:
+	// https://github.com/kubernetes/community/blob/master/contributors/devel/api-conventions.md#metadata
+	metav1.ListMeta `json:"metadata"`
+	// List of DatabaseServers.
+	Items []DatabaseServer `json:"items"`
+}
+
+// DatabaseServer defines a database server shared by Database resources (cluster-scoped).
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DatabaseServer struct {
+	metav1.TypeMeta `json:",inline"`
+	// Standard object’s metadata. More info:
+	// https://github.com/kubernetes/community/blob/master/contributors/devel/api-conventions.md#metadata
+	// +k8s:openapi-gen=false
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Specification of the database server. More info:
+	// https://github.com/kubernetes/community/blob/master/contributors/devel/api-conventions.md#spec-and-status
+	Spec DatabaseServerSpec `json:"spec"`
+	// Most recent observed status of the database server. Read-only.
+	// https://github.com/kubernetes/community/blob/master/contributors/devel/api-conventions.md#spec-and-status
+	Status DatabaseServerStatus `json:"status,omitempty"`
+}
+
+// DatabaseServerSpec is a specification of the database server. More info:
+// https://github.com/kubernetes/community/blob/master/contributors/devel/api-conventions.md#spec-and-status
+type DatabaseServerSpec struct {
+	// Database type (currently supported database server types: mysql, postgresql).
+	Type string `json:"type"`
+	// Database server host.
+	Host string `json:"host"`
+	// Database server port.
+	Port int32 `json:"port"`
+	// User to be used (it must have enough permissions to create/drop databases and users)
+	RootUser string `json:"rootUser"`
+	// Secret containing password for the user
+	RootPasswordSecretRef NamespacedSecretRef `json:"rootPasswordSecretRef"`
+	// SSL mode of the connections (only supported by postgresql: disable (default), allow, prefer, require,
+	// verify-ca or verify-full).
+	SSLMode string `json:"sslMode,omitempty"`
+	// Drop orphaned databases and users marked by this operator instance as managed by already deleted Database
+	// resources (orphans are only reported if not set)
+	CollectOrphans bool `json:"collectOrphans,omitempty"`
+}
+
+// DatabaseServerStatus defines most recent observed status of the database server. Read-only. More info:
+// https://github.com/kubernetes/community/blob/master/contributors/devel/api-conventions.md#spec-and-status
+type DatabaseServerStatus struct {
+	// Whether the operator was able to connect to the server during the last check.
+	Reachable bool `json:"reachable"`
+	// Server version (e.g. MySQL 8.0.12).
+	Version string `json:"version,omitempty"`
+	// Reason why the server is not reachable.
+	Message string `json:"message,omitempty"`
+	// Stores last check timestamp
+	LastCheckTimestamp *int64 `json:"lastCheckTimestamp,omitempty"`
+	// Databases and users on the server not used by any Database resource (at most 100 are listed).
+	Orphans []OrphanObject `json:"orphans,omitempty"`
+	// Total number of orphaned databases and users.
+	OrphanCount int32 `json:"orphanCount,omitempty"`
+}
+
+// OrphanObject describes the database or user on the server not used by any Database resource.
+type OrphanObject struct {
+	// Object kind (database or user).
+	Kind string `json:"kind"`
+	// Object name.
+	Name string `json:"name"`
+	// Deleted Database resource (namespace/name) which created the object (empty if the object is not marked by
+	// the operator).
+	Owner string `json:"owner,omitempty"`
+}
+
+// PendingObject describes the database or user being created by the resource.
+type PendingObject struct {
+	// Object kind (database or user).
+	Kind string `json:"kind"`
+	// Object name.
+	Name string `json:"name"`
+}
+
+// OutputSecretObject defines Secret created with the database connection details. The Secret is owned by
+// the Database resource.
+type OutputSecretObject struct {
+	// Secret name
+	Name string `json:"name"`
+	// Secret keys mapped to Go templates of their values (e.g. DATABASE_URL: "{{ .URI }}"). Available fields:
+	// Host, Port, Database, User, Password, DSN, URI and JDBCURL. If not set, the Secret contains keys: user,
+	// password, host, port, database, dsn, uri and jdbcUrl.
+	Keys map[string]string `json:"keys,omitempty"`
+}
+
+// RotationObject defines automatic credentials rotation. The operator alternates between two database users
+// (<user>_a and <user>_b): it creates new credentials for the inactive one, publishes them in the output Secret
+// and drops the previous user after the grace period. Rotation requires generated passwords (passwordSecretRef
+// can't be set).
+type RotationObject struct {
+	// Time between rotations (e.g. 720h).
+	Interval string `json:"interval"`
+	// Time after which the previous user is dropped (e.g. 24h, 1h by default).
+	GracePeriod string `json:"gracePeriod,omitempty"`
 }
 
 // OptionsObject defines additional options.
 type OptionsObject struct {
 	// Drop managed database and user when Database resource is deleted.
+	// Deprecated: use deletionPolicy (true is the same as Delete, false as Retain).
 	DropOnDelete *bool `json:"dropOnDelete,omitempty"`
+	// What happens to the database and its users when Database resource is deleted: Delete (default), Retain,
+	// RetainData (only users are dropped) or Snapshot (the database is dumped before it's dropped).
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+	// Where the database is dumped (required by Snapshot deletion policy).
+	Snapshot *SnapshotObject `json:"snapshot,omitempty"`
+	// What happens if the database or user already exists and is not managed by the resource: Fail (default),
+	// Adopt or AdoptAndRetain (adopted objects are never dropped, the same as Retain deletion policy).
+	AdoptionPolicy string `json:"adoptionPolicy,omitempty"`
+	// Block deletion of the resource until the protection is disabled (the database and its users are kept and
+	// the finalizer is not removed). It can be also enabled using jakub-bacic.github.com/deletion-protection
+	// annotation.
+	DeletionProtection bool `json:"deletionProtection,omitempty"`
 }
 
-func makePointer(val bool) *bool {
-	return &val
+// SnapshotObject defines the logical dump of the database taken before it's dropped. The dump is taken by a Job
+// (running mysqldump or pg_dump) and stored in the volume as <namespace>-<name>-<timestamp>.sql file.
+type SnapshotObject struct {
+	// PersistentVolumeClaim (in the resource namespace) the dump is written to.
+	PersistentVolumeClaim string `json:"persistentVolumeClaim"`
+	// Image with the dump tool (mysql:8.0 or postgres:11 by default).
+	Image string `json:"image,omitempty"`
 }
 
-func (db *Database) InitWithDefaults() {
+// InitWithDefaults sets defaults of the options missing in the spec (deletionPolicy is set to the given value)
+func (db *Database) InitWithDefaults(deletionPolicy string) {
 	if db.Spec.Options == nil {
 		db.Spec.Options = &OptionsObject{}
 	}
-	if db.Spec.Options.DropOnDelete == nil {
-		db.Spec.Options.DropOnDelete = makePointer(true)
+	if db.Spec.Options.DeletionPolicy == "" && db.Spec.Options.DropOnDelete == nil {
+		db.Spec.Options.DeletionPolicy = deletionPolicy
+	}
+	if db.Spec.Database.PasswordSecretRef == nil && db.Spec.OutputSecret == nil {
+		// generated password has to be stored somewhere
+		db.Spec.OutputSecret = &OutputSecretObject{Name: db.Name + "-credentials"}
 	}
 
 	db.SetStatus(StatusCreating)
@@ -133,17 +407,214 @@ func (db *Database) SetStatus(status string) {
 		db.Status.LastErrorTimestamp = &now
 	} else {
 		db.Status.LastErrorTimestamp = nil
+		db.Status.Reason = ""
+		db.Status.Message = ""
+	}
+	if status == StatusCreated {
+		db.Status.RetryCount = 0
+		db.Status.NextRetryTimestamp = nil
+		db.Status.FailedSpecHash = ""
 	}
 	db.Status.Status = status
+	db.updateReadyCondition()
 }
 
-func (db *Database) TimeSinceLastError() int64 {
-	now := int64(time.Now().Unix())
-	return now - *db.Status.LastErrorTimestamp
+func (db *Database) SetError(reason string, message string) {
+	db.SetStatus(StatusError)
+	db.Status.Reason = reason
+	db.Status.Message = message
+	db.updateReadyCondition()
+}
+
+// updateReadyCondition sets Ready condition according to the current status (the database is ready once it's
+// created).
+func (db *Database) updateReadyCondition() {
+	switch db.Status.Status {
+	case StatusCreated:
+		db.SetCondition(ConditionReady, corev1.ConditionTrue, StatusCreated, "")
+	case StatusError:
+		db.SetCondition(ConditionReady, corev1.ConditionFalse, db.Status.Reason, db.Status.Message)
+	default:
+		db.SetCondition(ConditionReady, corev1.ConditionFalse, db.Status.Status, "")
+	}
+}
+
+// PasswordHash returns salted hash of the given password of the database user.
+func (db *Database) PasswordHash(password string) string {
+	hash := sha256.Sum256([]byte(string(db.UID) + ":" + password))
+	return hex.EncodeToString(hash[:])
+}
+
+// SetPasswordHash stores hash of the current password of the database user.
+func (db *Database) SetPasswordHash(passwordHash string) {
+	if db.Status.PasswordHash != "" && db.Status.PasswordHash != passwordHash {
+		now := int64(time.Now().Unix())
+		db.Status.PasswordUpdateTimestamp = &now
+	}
+	db.Status.PasswordHash = passwordHash
+}
+
+// GetCondition returns the condition of the given type or nil if it's not set.
+func (db *Database) GetCondition(conditionType string) *Condition {
+	for i := range db.Status.Conditions {
+		if db.Status.Conditions[i].Type == conditionType {
+			return &db.Status.Conditions[i]
+		}
+	}
+	return nil
 }
 
-func (db *Database) DropOnDelete() bool {
-	return *db.Spec.Options.DropOnDelete
+// SetCondition sets the condition of the given type and returns true if it's been changed. Transition time is
+// updated only when the condition status changes.
+func (db *Database) SetCondition(conditionType string, status corev1.ConditionStatus, reason string,
+	message string) bool {
+	condition := db.GetCondition(conditionType)
+	if condition == nil {
+		db.Status.Conditions = append(db.Status.Conditions, Condition{
+			Type:               conditionType,
+			Status:             status,
+			LastTransitionTime: metav1.Now(),
+			Reason:             reason,
+			Message:            message,
+		})
+		return true
+	}
+
+	if condition.Status == status && condition.Reason == reason && condition.Message == message {
+		return false
+	}
+	if condition.Status != status {
+		condition.LastTransitionTime = metav1.Now()
+	}
+	condition.Status = status
+	condition.Reason = reason
+	condition.Message = message
+	return true
+}
+
+// ScheduleRetry increments the retry count and sets time of the next retry after the given delay.
+func (db *Database) ScheduleRetry(delay time.Duration) {
+	db.Status.RetryCount++
+	nextRetry := time.Now().Add(delay).Unix()
+	db.Status.NextRetryTimestamp = &nextRetry
+	db.Status.FailedSpecHash = ""
+}
+
+// SetPermanentFailure disables retries until the spec changes.
+func (db *Database) SetPermanentFailure() {
+	db.Status.NextRetryTimestamp = nil
+	db.Status.FailedSpecHash = db.SpecHash()
+}
+
+// ShouldRetry checks if the failed operation should be retried. Permanent failures are retried once the spec
+// changes or the resource is being deleted (failures of the deletion itself are never permanent).
+func (db *Database) ShouldRetry() bool {
+	if db.Status.FailedSpecHash != "" {
+		return db.DeletionTimestamp != nil || db.SpecHash() != db.Status.FailedSpecHash
+	}
+	if db.Status.NextRetryTimestamp == nil {
+		return true
+	}
+	return time.Now().Unix() >= *db.Status.NextRetryTimestamp
+}
+
+// SpecHash returns hash of the spec (used to detect spec changes).
+func (db *Database) SpecHash() string {
+	// map keys are sorted, so the encoding is stable
+	spec, _ := json.Marshal(db.Spec)
+	hash := sha256.Sum256(spec)
+	return hex.EncodeToString(hash[:])
+}
+
+// DeletionPolicy returns the deletion policy of the resource (deprecated dropOnDelete is used if it's not set, the
+// given default policy if neither of them is set).
+// Adopted objects are always retained with AdoptAndRetain adoption policy.
+func (db *Database) DeletionPolicy(defaultPolicy string) string {
+	options := db.Spec.Options
+	switch {
+	case options == nil:
+		return defaultPolicy
+	case db.Status.Adopted && options.AdoptionPolicy == AdoptionPolicyAdoptAndRetain:
+		return DeletionPolicyRetain
+	case options.DeletionPolicy != "":
+		return options.DeletionPolicy
+	case options.DropOnDelete != nil && !*options.DropOnDelete:
+		return DeletionPolicyRetain
+	case options.DropOnDelete != nil:
+		return DeletionPolicyDelete
+	default:
+		return defaultPolicy
+	}
+}
+
+// AdoptionPolicy returns the adoption policy of the resource (Fail if it's not set)
+func (db *Database) AdoptionPolicy() string {
+	if db.Spec.Options == nil || db.Spec.Options.AdoptionPolicy == "" {
+		return AdoptionPolicyFail
+	}
+	return db.Spec.Options.AdoptionPolicy
+}
+
+// OwnershipMarker returns the marker identifying the resource (handled by the operator instance with the given ID)
+// as the owner of objects on the database server
+func (db *Database) OwnershipMarker(instanceID string) string {
+	return fmt.Sprintf("%v%v:%v/%v:%v", ownershipMarkerPrefix, instanceID, db.Namespace, db.Name, db.UID)
+}
+
+// MarkerOwner describes the resource identified by the ownership marker.
+// +k8s:deepcopy-gen=false
+type MarkerOwner struct {
+	// ID of the operator instance (empty for markers set by the previous versions of the operator)
+	InstanceID string
+	Namespace  string
+	Name       string
+	UID        string
+}
+
+// ParseOwnershipMarker returns the resource identified by the marker (ok is false if the marker hasn't been set by
+// the operator). Markers set by the previous versions of the operator don't contain the instance ID.
+func ParseOwnershipMarker(marker string) (owner MarkerOwner, ok bool) {
+	if !strings.HasPrefix(marker, ownershipMarkerPrefix) {
+		return MarkerOwner{}, false
+	}
+	// instance IDs, namespaces and names can contain neither slashes nor colons
+	parts := strings.Split(strings.TrimPrefix(marker, ownershipMarkerPrefix), ":")
+	switch len(parts) {
+	case 2:
+	case 3:
+		if parts[0] == "" {
+			return MarkerOwner{}, false
+		}
+		owner.InstanceID = parts[0]
+		parts = parts[1:]
+	default:
+		return MarkerOwner{}, false
+	}
+	resource := strings.Split(parts[0], "/")
+	if len(resource) != 2 || resource[0] == "" || resource[1] == "" || parts[1] == "" {
+		return MarkerOwner{}, false
+	}
+	owner.Namespace, owner.Name, owner.UID = resource[0], resource[1], parts[1]
+	return owner, true
+}
+
+// Owns checks if the marker identifies the resource (instance ID is not compared, so markers set by the previous
+// versions of the operator are accepted as well).
+func (owner MarkerOwner) Owns(db *Database) bool {
+	return owner.Namespace == db.Namespace && owner.Name == db.Name && owner.UID == string(db.UID)
+}
+
+// DeletionProtected returns true if the deletion protection is enabled (using the option or annotation)
+func (db *Database) DeletionProtected() bool {
+	if db.Annotations[AnnotationDeletionProtection] == "true" {
+		return true
+	}
+	return db.Spec.Options != nil && db.Spec.Options.DeletionProtection
+}
+
+// GeneratedPassword returns true if the operator is responsible for generating password for the database user.
+func (db *Database) GeneratedPassword() bool {
+	return db.Spec.Database.PasswordSecretRef == nil
 }
 
 func (db *Database) GetDatabaseUserCredentials() (*database.Credentials, error) {
@@ -151,12 +622,93 @@ func (db *Database) GetDatabaseUserCredentials() (*database.Credentials, error)
 	user := db.Spec.Database.User
 
 	passwordSecretRef := db.Spec.Database.PasswordSecretRef
+	if passwordSecretRef == nil {
+		return nil, fmt.Errorf("passwordSecretRef is not set")
+	}
 	password, err := getSecretKey(namespace, passwordSecretRef.Name, passwordSecretRef.Key)
 	if err != nil {
 		return nil, err
 	}
 
-	return &database.Credentials{user, *password}, nil
+	return &database.Credentials{User: user, Password: *password}, nil
+}
+
+// ActiveUser returns the database user currently used by the application (it differs from the configured user when
+// the credentials rotation is enabled).
+func (db *Database) ActiveUser() string {
+	if db.Status.Rotation != nil {
+		return db.Status.Rotation.ActiveUser
+	}
+	return db.Spec.Database.User
+}
+
+// RotationUsers returns the pair of users used by the credentials rotation.
+func (db *Database) RotationUsers() (string, string) {
+	user := db.Spec.Database.User
+	return user + "_a", user + "_b"
+}
+
+// GetRotationPolicy returns interval and grace period of the credentials rotation.
+func (db *Database) GetRotationPolicy() (time.Duration, time.Duration, error) {
+	rotation := db.Spec.Rotation
+	if rotation == nil {
+		return 0, 0, fmt.Errorf("rotation is not set")
+	}
+
+	interval, err := time.ParseDuration(rotation.Interval)
+	if err != nil || interval <= 0 {
+		return 0, 0, fmt.Errorf("invalid rotation interval: %v", rotation.Interval)
+	}
+
+	gracePeriod := defaultRotationGracePeriod
+	if rotation.GracePeriod != "" {
+		gracePeriod, err = time.ParseDuration(rotation.GracePeriod)
+		if err != nil || gracePeriod < 0 {
+			return 0, 0, fmt.Errorf("invalid rotation grace period: %v", rotation.GracePeriod)
+		}
+	}
+	return interval, gracePeriod, nil
+}
+
+// DatabaseServerID returns identifier of the database server (either the DatabaseServer resource or the address
+// of the server defined inline).
+func (db *Database) DatabaseServerID() string {
+	if db.Spec.DatabaseServerRef != nil {
+		return "databaseserver/" + db.Spec.DatabaseServerRef.Name
+	}
+	if server := db.Spec.DatabaseServer; server != nil {
+		return fmt.Sprintf("%v://%v:%v", server.Type, server.Host, server.Port)
+	}
+	return ""
+}
+
+// CurrentAppliedSpec returns the applied spec snapshot of the current spec.
+func (db *Database) CurrentAppliedSpec() *AppliedSpec {
+	return &AppliedSpec{
+		DatabaseName:   db.Spec.Database.Name,
+		User:           db.Spec.Database.User,
+		DatabaseServer: db.DatabaseServerID(),
+		Rotation:       db.Spec.Rotation != nil,
+	}
+}
+
+// SetAppliedSpec marks the current spec as applied on the database server.
+func (db *Database) SetAppliedSpec() {
+	db.Status.AppliedSpec = db.CurrentAppliedSpec()
+	db.Status.ObservedGeneration = db.Generation
+	// all objects have been created
+	db.Status.PendingObjects = nil
+}
+
+// DatabaseServerName returns name of the referenced DatabaseServer resource or host of the database server.
+func (db *Database) DatabaseServerName() string {
+	if db.Spec.DatabaseServerRef != nil {
+		return db.Spec.DatabaseServerRef.Name
+	}
+	if db.Spec.DatabaseServer != nil {
+		return db.Spec.DatabaseServer.Host
+	}
+	return ""
 }
 
 func (db *Database) GetDatabaseServerCredentials() (*database.Credentials, error) {
@@ -168,5 +720,42 @@ func (db *Database) GetDatabaseServerCredentials() (*database.Credentials, error
 	if err != nil {
 		return nil, err
 	}
-	return &database.Credentials{user, *password}, nil
+	return &database.Credentials{User: user, Password: *password}, nil
+}
+
+func (server *DatabaseServer) GetDatabaseServerCredentials() (*database.Credentials, error) {
+	user := server.Spec.RootUser
+
+	passwordSecretRef := server.Spec.RootPasswordSecretRef
+	password, err := getSecretKey(passwordSecretRef.Namespace, passwordSecretRef.Name, passwordSecretRef.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &database.Credentials{User: user, Password: *password}, nil
+}
+
+func (server *DatabaseServer) SetReachable(version string) {
+	server.Status.Reachable = true
+	server.Status.Version = version
+	server.Status.Message = ""
+	server.updateLastCheckTimestamp()
+}
+
+func (server *DatabaseServer) SetUnreachable(message string) {
+	server.Status.Reachable = false
+	server.Status.Message = message
+	server.updateLastCheckTimestamp()
+}
+
+func (server *DatabaseServer) TimeSinceLastCheck() int64 {
+	if server.Status.LastCheckTimestamp == nil {
+		return math.MaxInt64
+	}
+	now := int64(time.Now().Unix())
+	return now - *server.Status.LastCheckTimestamp
+}
+
+func (server *DatabaseServer) updateLastCheckTimestamp() {
+	now := int64(time.Now().Unix())
+	server.Status.LastCheckTimestamp = &now
 }
@@ -0,0 +1,87 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestOwnershipMarker(t *testing.T) {
+	db := &Database{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", UID: "1234-abcd"}}
+	marker := db.OwnershipMarker("5678-efgh")
+	if marker != "database-k8s-operator:5678-efgh:default/app:1234-abcd" {
+		t.Errorf("OwnershipMarker() = %q", marker)
+	}
+
+	owner, ok := ParseOwnershipMarker(marker)
+	want := MarkerOwner{InstanceID: "5678-efgh", Namespace: "default", Name: "app", UID: "1234-abcd"}
+	if !ok || owner != want {
+		t.Errorf("ParseOwnershipMarker(%q) = %+v, %v, want %+v", marker, owner, ok, want)
+	}
+	if !owner.Owns(db) {
+		t.Errorf("%+v doesn't own %v/%v", owner, db.Namespace, db.Name)
+	}
+}
+
+func TestParseOwnershipMarker(t *testing.T) {
+	tests := []struct {
+		marker string
+		want   MarkerOwner
+		ok     bool
+	}{
+		{"database-k8s-operator:cluster:default/app:uid", MarkerOwner{"cluster", "default", "app", "uid"}, true},
+		// set by the previous versions of the operator
+		{"database-k8s-operator:default/app:uid", MarkerOwner{"", "default", "app", "uid"}, true},
+		{"", MarkerOwner{}, false},
+		{"created manually", MarkerOwner{}, false},
+		{"other-operator:default/app:uid", MarkerOwner{}, false},
+		{"database-k8s-operator:", MarkerOwner{}, false},
+		{"database-k8s-operator::default/app:uid", MarkerOwner{}, false},
+		{"database-k8s-operator:cluster:default/app:", MarkerOwner{}, false},
+		{"database-k8s-operator:cluster:default:uid", MarkerOwner{}, false},
+		{"database-k8s-operator:cluster:/app:uid", MarkerOwner{}, false},
+		{"database-k8s-operator:cluster:default/:uid", MarkerOwner{}, false},
+		{"database-k8s-operator:cluster:default/app/x:uid", MarkerOwner{}, false},
+		{"database-k8s-operator:a:b:default/app:uid", MarkerOwner{}, false},
+	}
+	for _, test := range tests {
+		owner, ok := ParseOwnershipMarker(test.marker)
+		if ok != test.ok || owner != test.want {
+			t.Errorf("ParseOwnershipMarker(%q) = %+v, %v, want %+v, %v", test.marker, owner, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestMarkerOwnerOwns(t *testing.T) {
+	db := &Database{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", UID: "uid"}}
+	tests := []struct {
+		owner MarkerOwner
+		owns  bool
+	}{
+		{MarkerOwner{"cluster", "default", "app", "uid"}, true},
+		{MarkerOwner{"", "default", "app", "uid"}, true},
+		{MarkerOwner{"cluster", "default", "app", "other-uid"}, false},
+		{MarkerOwner{"cluster", "other", "app", "uid"}, false},
+		{MarkerOwner{"cluster", "default", "other", "uid"}, false},
+	}
+	for _, test := range tests {
+		if got := test.owner.Owns(db); got != test.owns {
+			t.Errorf("%+v.Owns() = %v, want %v", test.owner, got, test.owns)
+		}
+	}
+}
+
+func TestShouldRetryPermanentFailure(t *testing.T) {
+	db := &Database{}
+	db.Spec.Database.Name = "app"
+	db.SetPermanentFailure()
+	if db.ShouldRetry() {
+		t.Errorf("ShouldRetry() = true after permanent failure with unchanged spec")
+	}
+
+	now := metav1.Now()
+	db.DeletionTimestamp = &now
+	if !db.ShouldRetry() {
+		t.Errorf("ShouldRetry() = false after permanent failure of the resource being deleted")
+	}
+}
@@ -9,6 +9,15 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// SecretError is returned when a Secret used by the resource can't be read.
+type SecretError struct {
+	Message string
+}
+
+func (e *SecretError) Error() string {
+	return e.Message
+}
+
 func getSecret(namespace string, name string) (*v1.Secret, error) {
 	secret := &v1.Secret{
 		TypeMeta: metav1.TypeMeta{
@@ -22,7 +31,7 @@ func getSecret(namespace string, name string) (*v1.Secret, error) {
 	}
 	err := sdk.Get(secret)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get secret (%v/%v): %v", namespace, name, err)
+		return nil, &SecretError{fmt.Sprintf("failed to get secret (%v/%v): %v", namespace, name, err)}
 	}
 	return secret, nil
 }
@@ -35,9 +44,29 @@ func getSecretKey(namespace string, name string, key string) (*string, error) {
 
 	bytes, ok := secret.Data[key]
 	if !ok {
-		return nil, fmt.Errorf("failed to read password from secret (%v/%v): key %v does not exist", namespace, name, key)
+		return nil, &SecretError{
+			fmt.Sprintf("failed to read password from secret (%v/%v): key %v does not exist", namespace, name, key),
+		}
 	}
 
 	secretValue := string(bytes)
 	return &secretValue, nil
 }
+
+// GetDatabaseServer returns DatabaseServer resource with the given name.
+func GetDatabaseServer(name string) (*DatabaseServer, error) {
+	server := &DatabaseServer{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "DatabaseServer",
+			APIVersion: SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+	}
+	err := sdk.Get(server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database server (%v): %v", name, err)
+	}
+	return server, nil
+}
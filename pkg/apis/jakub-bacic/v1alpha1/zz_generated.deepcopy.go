@@ -8,6 +8,39 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppliedSpec) DeepCopyInto(out *AppliedSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppliedSpec.
+func (in *AppliedSpec) DeepCopy() *AppliedSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AppliedSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Condition) DeepCopyInto(out *Condition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Condition.
+func (in *Condition) DeepCopy() *Condition {
+	if in == nil {
+		return nil
+	}
+	out := new(Condition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Database) DeepCopyInto(out *Database) {
 	*out = *in
@@ -72,7 +105,11 @@ func (in *DatabaseList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DatabaseObject) DeepCopyInto(out *DatabaseObject) {
 	*out = *in
-	out.PasswordSecretRef = in.PasswordSecretRef
+	if in.PasswordSecretRef != nil {
+		in, out := &in.PasswordSecretRef, &out.PasswordSecretRef
+		*out = new(SecretRef)
+		**out = **in
+	}
 	return
 }
 
@@ -86,6 +123,67 @@ func (in *DatabaseObject) DeepCopy() *DatabaseObject {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseServer) DeepCopyInto(out *DatabaseServer) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseServer.
+func (in *DatabaseServer) DeepCopy() *DatabaseServer {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseServer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DatabaseServer) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseServerList) DeepCopyInto(out *DatabaseServerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]DatabaseServer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseServerList.
+func (in *DatabaseServerList) DeepCopy() *DatabaseServerList {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseServerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DatabaseServerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DatabaseServerObject) DeepCopyInto(out *DatabaseServerObject) {
 	*out = *in
@@ -103,11 +201,73 @@ func (in *DatabaseServerObject) DeepCopy() *DatabaseServerObject {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseServerSpec) DeepCopyInto(out *DatabaseServerSpec) {
+	*out = *in
+	out.RootPasswordSecretRef = in.RootPasswordSecretRef
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseServerSpec.
+func (in *DatabaseServerSpec) DeepCopy() *DatabaseServerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseServerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseServerStatus) DeepCopyInto(out *DatabaseServerStatus) {
+	*out = *in
+	if in.LastCheckTimestamp != nil {
+		in, out := &in.LastCheckTimestamp, &out.LastCheckTimestamp
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Orphans != nil {
+		in, out := &in.Orphans, &out.Orphans
+		*out = make([]OrphanObject, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseServerStatus.
+func (in *DatabaseServerStatus) DeepCopy() *DatabaseServerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseServerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DatabaseSpec) DeepCopyInto(out *DatabaseSpec) {
 	*out = *in
-	out.Database = in.Database
-	out.DatabaseServer = in.DatabaseServer
+	in.Database.DeepCopyInto(&out.Database)
+	if in.DatabaseServer != nil {
+		in, out := &in.DatabaseServer, &out.DatabaseServer
+		*out = new(DatabaseServerObject)
+		**out = **in
+	}
+	if in.DatabaseServerRef != nil {
+		in, out := &in.DatabaseServerRef, &out.DatabaseServerRef
+		*out = new(ObjectRef)
+		**out = **in
+	}
+	if in.OutputSecret != nil {
+		in, out := &in.OutputSecret, &out.OutputSecret
+		*out = new(OutputSecretObject)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Rotation != nil {
+		in, out := &in.Rotation, &out.Rotation
+		*out = new(RotationObject)
+		**out = **in
+	}
 	if in.Options != nil {
 		in, out := &in.Options, &out.Options
 		*out = new(OptionsObject)
@@ -134,6 +294,38 @@ func (in *DatabaseStatus) DeepCopyInto(out *DatabaseStatus) {
 		*out = new(int64)
 		**out = **in
 	}
+	if in.NextRetryTimestamp != nil {
+		in, out := &in.NextRetryTimestamp, &out.NextRetryTimestamp
+		*out = new(int64)
+		**out = **in
+	}
+	if in.PasswordUpdateTimestamp != nil {
+		in, out := &in.PasswordUpdateTimestamp, &out.PasswordUpdateTimestamp
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Rotation != nil {
+		in, out := &in.Rotation, &out.Rotation
+		*out = new(RotationStatus)
+		**out = **in
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AppliedSpec != nil {
+		in, out := &in.AppliedSpec, &out.AppliedSpec
+		*out = new(AppliedSpec)
+		**out = **in
+	}
+	if in.PendingObjects != nil {
+		in, out := &in.PendingObjects, &out.PendingObjects
+		*out = make([]PendingObject, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -147,6 +339,22 @@ func (in *DatabaseStatus) DeepCopy() *DatabaseStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespacedSecretRef) DeepCopyInto(out *NamespacedSecretRef) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespacedSecretRef.
+func (in *NamespacedSecretRef) DeepCopy() *NamespacedSecretRef {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespacedSecretRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ObjectRef) DeepCopyInto(out *ObjectRef) {
 	*out = *in
@@ -171,6 +379,11 @@ func (in *OptionsObject) DeepCopyInto(out *OptionsObject) {
 		*out = new(bool)
 		**out = **in
 	}
+	if in.Snapshot != nil {
+		in, out := &in.Snapshot, &out.Snapshot
+		*out = new(SnapshotObject)
+		**out = **in
+	}
 	return
 }
 
@@ -184,6 +397,109 @@ func (in *OptionsObject) DeepCopy() *OptionsObject {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OrphanObject) DeepCopyInto(out *OrphanObject) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OrphanObject.
+func (in *OrphanObject) DeepCopy() *OrphanObject {
+	if in == nil {
+		return nil
+	}
+	out := new(OrphanObject)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OutputSecretObject) DeepCopyInto(out *OutputSecretObject) {
+	*out = *in
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OutputSecretObject.
+func (in *OutputSecretObject) DeepCopy() *OutputSecretObject {
+	if in == nil {
+		return nil
+	}
+	out := new(OutputSecretObject)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PendingObject) DeepCopyInto(out *PendingObject) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PendingObject.
+func (in *PendingObject) DeepCopy() *PendingObject {
+	if in == nil {
+		return nil
+	}
+	out := new(PendingObject)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RotationObject) DeepCopyInto(out *RotationObject) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RotationObject.
+func (in *RotationObject) DeepCopy() *RotationObject {
+	if in == nil {
+		return nil
+	}
+	out := new(RotationObject)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RotationStatus) DeepCopyInto(out *RotationStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RotationStatus.
+func (in *RotationStatus) DeepCopy() *RotationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RotationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretError) DeepCopyInto(out *SecretError) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretError.
+func (in *SecretError) DeepCopy() *SecretError {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretError)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecretRef) DeepCopyInto(out *SecretRef) {
 	*out = *in
@@ -199,3 +515,19 @@ func (in *SecretRef) DeepCopy() *SecretRef {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SnapshotObject) DeepCopyInto(out *SnapshotObject) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SnapshotObject.
+func (in *SnapshotObject) DeepCopy() *SnapshotObject {
+	if in == nil {
+		return nil
+	}
+	out := new(SnapshotObject)
+	in.DeepCopyInto(out)
+	return out
+}
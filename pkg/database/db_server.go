@@ -1,11 +1,126 @@
 package database
 
+import (
+	"database/sql"
+	"fmt"
+)
+
 type Credentials struct {
 	User     string `json:"user"`
 	Password string `json:"password"`
 }
 
 type DbServer interface {
-	CreateDatabase(dbName string, userCredentials *Credentials) error
-	DeleteDatabase(dbName string, user string) error
-}
\ No newline at end of file
+	// CreateDatabase creates the database owned by the given user (if the engine supports database ownership)
+	CreateDatabase(dbName string, owner string) error
+	// DeleteDatabase drops the database (including all its data)
+	DeleteDatabase(dbName string) error
+	// CreateUser creates the user (or updates password of the existing one) with all privileges to the database
+	// owned by the given user (if the engine supports database ownership)
+	CreateUser(dbName string, owner string, userCredentials *Credentials) error
+	// DeleteUser drops the user
+	DeleteUser(dbName string, user string) error
+	// GetDatabaseState checks which of the objects created by CreateDatabase and CreateUser exist on the server
+	GetDatabaseState(dbName string, owner string, user string) (*DatabaseState, error)
+	// UpdateUserPassword changes password of the existing user
+	UpdateUserPassword(userCredentials *Credentials) error
+	// GetVersion connects to the server and returns its version (e.g. MySQL 8.0.12)
+	GetVersion() (string, error)
+	// GetConnectionDetails returns details needed by the user to connect to the database
+	GetConnectionDetails(dbName string, userCredentials *Credentials) *ConnectionDetails
+	// GetOwnershipMarker checks if the database or user exists and returns its ownership marker (empty if the object
+	// is not marked)
+	GetOwnershipMarker(kind ObjectKind, name string) (bool, string, error)
+	// SetOwnershipMarker marks the database or user as managed by the resource identified by the marker (empty
+	// marker removes it). It's a no-op if the object doesn't exist.
+	SetOwnershipMarker(kind ObjectKind, name string, marker string) error
+	// ListObjects returns databases and users on the server (except the system ones and the root user) together with
+	// their ownership markers
+	ListObjects() ([]ServerObject, error)
+}
+
+// ObjectKind defines kind of the object on the database server.
+type ObjectKind string
+
+const (
+	ObjectDatabase ObjectKind = "database"
+	ObjectUser     ObjectKind = "user"
+)
+
+// ServerObject identifies the database or user on the database server.
+type ServerObject struct {
+	Kind ObjectKind
+	Name string
+	// Ownership marker of the object (set only by ListObjects)
+	Marker string
+}
+
+// ConnectionError is returned when the database server can't be reached (e.g. due to network issues or invalid
+// root credentials).
+type ConnectionError struct {
+	Err error
+}
+
+func (e *ConnectionError) Error() string {
+	return fmt.Sprintf("failed to connect to database: %v", e.Err)
+}
+
+// DatabaseState describes objects managed by the operator on the database server.
+type DatabaseState struct {
+	DatabaseExists bool
+	// Whether the database is owned by the given owner (always true if the engine has no database ownership)
+	OwnerAssigned     bool
+	UserExists        bool
+	PrivilegesGranted bool
+}
+
+// Missing returns names of the missing objects (empty if the state is complete)
+func (state *DatabaseState) Missing() []string {
+	var missing []string
+	if !state.DatabaseExists {
+		missing = append(missing, "database")
+	} else if !state.OwnerAssigned {
+		missing = append(missing, "ownership")
+	}
+	if !state.UserExists {
+		missing = append(missing, "user")
+	}
+	if !state.PrivilegesGranted {
+		missing = append(missing, "privileges")
+	}
+	return missing
+}
+
+func exists(connection *sql.DB, query string, args ...interface{}) (bool, error) {
+	rows, err := connection.Query(query, args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	return rows.Next(), rows.Err()
+}
+
+// queryObjects returns objects of the given kind selected by the query (returning name and ownership marker of each
+// object)
+func queryObjects(connection *sql.DB, kind ObjectKind, query string, args ...interface{}) ([]ServerObject, error) {
+	rows, err := connection.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %vs: %v", kind, err)
+	}
+	defer rows.Close()
+
+	var objects []ServerObject
+	for rows.Next() {
+		var name string
+		var marker sql.NullString
+		if err := rows.Scan(&name, &marker); err != nil {
+			return nil, fmt.Errorf("failed to list %vs: %v", kind, err)
+		}
+		objects = append(objects, ServerObject{Kind: kind, Name: name, Marker: marker.String})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list %vs: %v", kind, err)
+	}
+	return objects, nil
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"time"
+
+	"github.com/jakub-bacic/database-k8s-operator/pkg/metrics"
+)
+
+// instrumentedServer records duration of the operations and connection failures of the wrapped server.
+type instrumentedServer struct {
+	server DbServer
+	// server and engine labels of the metrics
+	name   string
+	engine string
+}
+
+// NewInstrumentedServer returns the server recording metrics of the operations (name and engine are used as labels)
+func NewInstrumentedServer(server DbServer, name string, engine string) DbServer {
+	return &instrumentedServer{server: server, name: name, engine: engine}
+}
+
+func (s *instrumentedServer) CreateDatabase(dbName string, owner string) error {
+	start := time.Now()
+	err := s.server.CreateDatabase(dbName, owner)
+	s.observe("create_database", start, err)
+	return err
+}
+
+func (s *instrumentedServer) DeleteDatabase(dbName string) error {
+	start := time.Now()
+	err := s.server.DeleteDatabase(dbName)
+	s.observe("delete_database", start, err)
+	return err
+}
+
+func (s *instrumentedServer) CreateUser(dbName string, owner string, userCredentials *Credentials) error {
+	start := time.Now()
+	err := s.server.CreateUser(dbName, owner, userCredentials)
+	s.observe("create_user", start, err)
+	return err
+}
+
+func (s *instrumentedServer) DeleteUser(dbName string, user string) error {
+	start := time.Now()
+	err := s.server.DeleteUser(dbName, user)
+	s.observe("delete_user", start, err)
+	return err
+}
+
+func (s *instrumentedServer) GetDatabaseState(dbName string, owner string, user string) (*DatabaseState, error) {
+	start := time.Now()
+	state, err := s.server.GetDatabaseState(dbName, owner, user)
+	s.observe("get_database_state", start, err)
+	return state, err
+}
+
+func (s *instrumentedServer) UpdateUserPassword(userCredentials *Credentials) error {
+	start := time.Now()
+	err := s.server.UpdateUserPassword(userCredentials)
+	s.observe("update_user_password", start, err)
+	return err
+}
+
+func (s *instrumentedServer) GetVersion() (string, error) {
+	start := time.Now()
+	version, err := s.server.GetVersion()
+	s.observe("get_version", start, err)
+	return version, err
+}
+
+func (s *instrumentedServer) GetConnectionDetails(dbName string, userCredentials *Credentials) *ConnectionDetails {
+	return s.server.GetConnectionDetails(dbName, userCredentials)
+}
+
+func (s *instrumentedServer) GetOwnershipMarker(kind ObjectKind, name string) (bool, string, error) {
+	start := time.Now()
+	exists, marker, err := s.server.GetOwnershipMarker(kind, name)
+	s.observe("get_ownership_marker", start, err)
+	return exists, marker, err
+}
+
+func (s *instrumentedServer) SetOwnershipMarker(kind ObjectKind, name string, marker string) error {
+	start := time.Now()
+	err := s.server.SetOwnershipMarker(kind, name, marker)
+	s.observe("set_ownership_marker", start, err)
+	return err
+}
+
+func (s *instrumentedServer) ListObjects() ([]ServerObject, error) {
+	start := time.Now()
+	objects, err := s.server.ListObjects()
+	s.observe("list_objects", start, err)
+	return objects, err
+}
+
+func (s *instrumentedServer) observe(operation string, start time.Time, err error) {
+	if _, ok := err.(*ValidationError); ok {
+		// rejected before reaching the server
+		return
+	}
+	metrics.ObserveOperation(s.name, s.engine, operation, err, time.Since(start))
+	if _, ok := err.(*ConnectionError); ok {
+		metrics.IncConnectionFailures(s.name, s.engine)
+	}
+}
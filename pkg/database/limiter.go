@@ -0,0 +1,102 @@
+package database
+
+import "sync"
+
+// Limiter limits the number of concurrent operations (each of them opens its own connection) on the database
+// servers, so e.g. creating many databases at once doesn't exhaust connections of the server.
+type Limiter struct {
+	limit int
+	mutex sync.Mutex
+	// semaphores of the servers (keyed by name)
+	slots map[string]chan struct{}
+}
+
+// NewLimiter returns the limiter allowing the given number of concurrent operations per server (0 means no limit)
+func NewLimiter(limit int) *Limiter {
+	return &Limiter{limit: limit, slots: map[string]chan struct{}{}}
+}
+
+// Limit returns the server whose operations wait until there are less than limit operations running on the server
+// with the given name (e.g. host:port)
+func (l *Limiter) Limit(server DbServer, name string) DbServer {
+	if l.limit <= 0 {
+		return server
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	slots, ok := l.slots[name]
+	if !ok {
+		slots = make(chan struct{}, l.limit)
+		l.slots[name] = slots
+	}
+	return &limitedServer{server: server, slots: slots}
+}
+
+// limitedServer runs operations of the wrapped server only if there's a free slot (blocks otherwise).
+type limitedServer struct {
+	server DbServer
+	slots  chan struct{}
+}
+
+func (s *limitedServer) acquire() func() {
+	s.slots <- struct{}{}
+	return func() {
+		<-s.slots
+	}
+}
+
+func (s *limitedServer) CreateDatabase(dbName string, owner string) error {
+	defer s.acquire()()
+	return s.server.CreateDatabase(dbName, owner)
+}
+
+func (s *limitedServer) DeleteDatabase(dbName string) error {
+	defer s.acquire()()
+	return s.server.DeleteDatabase(dbName)
+}
+
+func (s *limitedServer) CreateUser(dbName string, owner string, userCredentials *Credentials) error {
+	defer s.acquire()()
+	return s.server.CreateUser(dbName, owner, userCredentials)
+}
+
+func (s *limitedServer) DeleteUser(dbName string, user string) error {
+	defer s.acquire()()
+	return s.server.DeleteUser(dbName, user)
+}
+
+func (s *limitedServer) GetDatabaseState(dbName string, owner string, user string) (*DatabaseState, error) {
+	defer s.acquire()()
+	return s.server.GetDatabaseState(dbName, owner, user)
+}
+
+func (s *limitedServer) UpdateUserPassword(userCredentials *Credentials) error {
+	defer s.acquire()()
+	return s.server.UpdateUserPassword(userCredentials)
+}
+
+func (s *limitedServer) GetVersion() (string, error) {
+	defer s.acquire()()
+	return s.server.GetVersion()
+}
+
+func (s *limitedServer) GetOwnershipMarker(kind ObjectKind, name string) (bool, string, error) {
+	defer s.acquire()()
+	return s.server.GetOwnershipMarker(kind, name)
+}
+
+func (s *limitedServer) SetOwnershipMarker(kind ObjectKind, name string, marker string) error {
+	defer s.acquire()()
+	return s.server.SetOwnershipMarker(kind, name, marker)
+}
+
+func (s *limitedServer) ListObjects() ([]ServerObject, error) {
+	defer s.acquire()()
+	return s.server.ListObjects()
+}
+
+func (s *limitedServer) GetConnectionDetails(dbName string, userCredentials *Credentials) *ConnectionDetails {
+	// no connection is opened
+	return s.server.GetConnectionDetails(dbName, userCredentials)
+}
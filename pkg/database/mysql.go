@@ -3,57 +3,442 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	AuthPluginMySQLNativePassword = "mysql_native_password"
+	AuthPluginCachingSHA2Password = "caching_sha2_password"
+)
+
+// noBackslashEscapesDisabled is the session sql_mode without NO_BACKSLASH_ESCAPES (other modes are kept)
+const noBackslashEscapesDisabled = "TRIM(BOTH ',' FROM REPLACE(CONCAT(',', @@SESSION.sql_mode, ','), " +
+	"',NO_BACKSLASH_ESCAPES,', ','))"
+
+// MySQL has no comments on databases, so ownership markers are stored in the separate table (created on demand)
+const (
+	markersSchema = "database_k8s_operator"
+	markersTable  = "ownership_markers"
 )
 
 type MySQLServer struct {
-	Host string
-	Port int32
+	Host        string
+	Port        int32
 	Credentials *Credentials
+	// Authentication plugin for the created users (server default is used if empty)
+	AuthPlugin string
 }
 
-func (server *MySQLServer) CreateDatabase(dbName string, userCredentials *Credentials) error {
+// CreateDatabase creates the database. MySQL has no database ownership, so the owner is not used.
+func (server *MySQLServer) CreateDatabase(dbName string, owner string) error {
+	if err := mySQLDialect.validateDatabaseName(dbName); err != nil {
+		return err
+	}
+
 	connection, err := server.openDatabase()
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %v", err)
+		return &ConnectionError{err}
 	}
 	defer connection.Close()
 
-	_, err = connection.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", dbName))
+	_, err = connection.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", mySQLDialect.quoteIdentifier(dbName)))
 	if err != nil {
 		return fmt.Errorf("failed to create database: %v", err)
 	}
 
-	_, err = connection.Exec(fmt.Sprintf("GRANT ALL PRIVILEGES ON `%s`.* TO `%s`@`%%` IDENTIFIED BY '%s'",
-		dbName, userCredentials.User, userCredentials.Password))
+	return nil
+}
+
+func (server *MySQLServer) DeleteDatabase(dbName string) error {
+	if err := mySQLDialect.validateDatabaseName(dbName); err != nil {
+		return err
+	}
+
+	connection, err := server.openDatabase()
+	if err != nil {
+		return &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	_, err = connection.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s", mySQLDialect.quoteIdentifier(dbName)))
+	if err != nil {
+		return fmt.Errorf("failed to delete database: %v", err)
+	}
+
+	return deleteOwnershipMarker(connection, ObjectDatabase, dbName)
+}
+
+// CreateUser creates the user with all privileges to the database (owner is not used)
+func (server *MySQLServer) CreateUser(dbName string, owner string, userCredentials *Credentials) error {
+	if err := mySQLDialect.validateDatabaseName(dbName); err != nil {
+		return err
+	}
+	if err := mySQLDialect.validateCredentials(userCredentials); err != nil {
+		return err
+	}
+
+	connection, err := server.openDatabase()
+	if err != nil {
+		return &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	version, err := server.queryVersion(connection)
+	if err != nil {
+		return err
+	}
+	if !version.SupportsAuthPlugin(server.AuthPlugin) {
+		return newValidationError(ReasonUnsupportedAuthPlugin, "authentication plugin %v is not supported by %v",
+			server.AuthPlugin, version)
+	}
+
+	if !version.SupportsCreateUserIfNotExists() || !version.SupportsAlterUser() {
+		// legacy flow, removed in MySQL 8.0
+		_, err = connection.Exec(fmt.Sprintf("GRANT ALL PRIVILEGES ON %s TO %s IDENTIFIED BY %s",
+			grantLevel(dbName), account(userCredentials.User), mySQLDialect.quoteLiteral(userCredentials.Password)))
+		if err != nil {
+			return fmt.Errorf("failed to create user: %v", err)
+		}
+		return nil
+	}
+
+	identification := server.identification(version, userCredentials.Password)
+	_, err = connection.Exec(fmt.Sprintf("CREATE USER IF NOT EXISTS %s %s", account(userCredentials.User), identification))
 	if err != nil {
 		return fmt.Errorf("failed to create user: %v", err)
 	}
 
+	// user might have already existed, make sure it has the desired password
+	_, err = connection.Exec(fmt.Sprintf("ALTER USER %s %s", account(userCredentials.User), identification))
+	if err != nil {
+		return fmt.Errorf("failed to update user: %v", err)
+	}
+
+	_, err = connection.Exec(fmt.Sprintf("GRANT ALL PRIVILEGES ON %s TO %s", grantLevel(dbName), account(userCredentials.User)))
+	if err != nil {
+		return fmt.Errorf("failed to grant privileges: %v", err)
+	}
+
 	return nil
 }
 
-func (server *MySQLServer) DeleteDatabase(dbName string, user string) error {
+func (server *MySQLServer) DeleteUser(dbName string, user string) error {
+	if err := mySQLDialect.validateUserName(user); err != nil {
+		return err
+	}
+
 	connection, err := server.openDatabase()
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %v", err)
+		return &ConnectionError{err}
 	}
 	defer connection.Close()
 
-	_, err = connection.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS `%s`", dbName))
+	version, err := server.queryVersion(connection)
 	if err != nil {
-		return fmt.Errorf("failed to delete database: %v", err)
+		return err
 	}
 
-	_, err = connection.Exec(fmt.Sprintf("DROP USER IF EXISTS `%s`", user))
+	if version.SupportsDropUserIfExists() {
+		_, err = connection.Exec(fmt.Sprintf("DROP USER IF EXISTS %s", account(user)))
+	} else {
+		var userExists bool
+		userExists, err = exists(connection, "SELECT 1 FROM mysql.user WHERE User = ? AND Host = '%'", user)
+		if err == nil && userExists {
+			_, err = connection.Exec(fmt.Sprintf("DROP USER %s", account(user)))
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %v", err)
 	}
 
+	return deleteOwnershipMarker(connection, ObjectUser, user)
+}
+
+// GetDatabaseState checks if the database and the user with privileges to the database exist (owner is not used)
+func (server *MySQLServer) GetDatabaseState(dbName string, owner string, user string) (*DatabaseState, error) {
+	connection, err := server.openDatabase()
+	if err != nil {
+		return nil, &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	// MySQL has no database ownership
+	state := &DatabaseState{OwnerAssigned: true}
+	state.DatabaseExists, err = exists(connection, "SELECT 1 FROM information_schema.schemata WHERE schema_name = ?", dbName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if database exists: %v", err)
+	}
+
+	state.UserExists, err = exists(connection, "SELECT 1 FROM mysql.user WHERE User = ? AND Host = '%'", user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if user exists: %v", err)
+	}
+
+	// database-level privileges are stored using the escaped name (the same as in GRANT statement), the row is
+	// removed when all privileges are revoked
+	escapedDbName := strings.NewReplacer("_", `\_`, "%", `\%`).Replace(dbName)
+	state.PrivilegesGranted, err = exists(connection, "SELECT 1 FROM mysql.db WHERE Db = ? AND User = ? AND Host = '%'",
+		escapedDbName, user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check user privileges: %v", err)
+	}
+	return state, nil
+}
+
+func (server *MySQLServer) UpdateUserPassword(userCredentials *Credentials) error {
+	if err := mySQLDialect.validateCredentials(userCredentials); err != nil {
+		return err
+	}
+
+	connection, err := server.openDatabase()
+	if err != nil {
+		return &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	version, err := server.queryVersion(connection)
+	if err != nil {
+		return err
+	}
+
+	if version.SupportsAlterUser() {
+		_, err = connection.Exec(fmt.Sprintf("ALTER USER %s %s", account(userCredentials.User),
+			server.identification(version, userCredentials.Password)))
+	} else {
+		_, err = connection.Exec(fmt.Sprintf("SET PASSWORD FOR %s = PASSWORD(%s)", account(userCredentials.User),
+			mySQLDialect.quoteLiteral(userCredentials.Password)))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update user: %v", err)
+	}
+
+	return nil
+}
+
+func (server *MySQLServer) GetOwnershipMarker(kind ObjectKind, name string) (bool, string, error) {
+	connection, err := server.openDatabase()
+	if err != nil {
+		return false, "", &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	var objectExists bool
+	switch kind {
+	case ObjectDatabase:
+		objectExists, err = exists(connection, "SELECT 1 FROM information_schema.schemata WHERE schema_name = ?", name)
+	case ObjectUser:
+		objectExists, err = exists(connection, "SELECT 1 FROM mysql.user WHERE User = ? AND Host = '%'", name)
+	default:
+		return false, "", fmt.Errorf("unsupported object kind: %v", kind)
+	}
+	if err != nil {
+		return false, "", fmt.Errorf("failed to check if %v exists: %v", kind, err)
+	}
+	if !objectExists {
+		return false, "", nil
+	}
+
+	tableExists, err := markersTableExists(connection)
+	if err != nil || !tableExists {
+		return true, "", err
+	}
+	var marker string
+	err = connection.QueryRow(fmt.Sprintf("SELECT marker FROM %s WHERE kind = ? AND name = ?", markersTableName()),
+		string(kind), name).Scan(&marker)
+	if err != nil && err != sql.ErrNoRows {
+		return false, "", fmt.Errorf("failed to get ownership marker: %v", err)
+	}
+	return true, marker, nil
+}
+
+// SetOwnershipMarker stores the marker in the markers table (it's a no-op if the object doesn't exist, empty marker
+// deletes the row)
+func (server *MySQLServer) SetOwnershipMarker(kind ObjectKind, name string, marker string) error {
+	objectExists, _, err := server.GetOwnershipMarker(kind, name)
+	if err != nil || !objectExists {
+		return err
+	}
+
+	connection, err := server.openDatabase()
+	if err != nil {
+		return &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	if marker == "" {
+		return deleteOwnershipMarker(connection, kind, name)
+	}
+
+	_, err = connection.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", mySQLDialect.quoteIdentifier(markersSchema)))
+	if err != nil {
+		return fmt.Errorf("failed to create ownership markers database: %v", err)
+	}
+	// names are compared the same way as by the server (binary collation)
+	_, err = connection.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (kind VARCHAR(16) NOT NULL, "+
+		"name VARCHAR(64) NOT NULL, marker VARCHAR(255) NOT NULL, PRIMARY KEY (kind, name)) "+
+		"CHARACTER SET utf8mb4 COLLATE utf8mb4_bin", markersTableName()))
+	if err != nil {
+		return fmt.Errorf("failed to create ownership markers table: %v", err)
+	}
+
+	_, err = connection.Exec(fmt.Sprintf("REPLACE INTO %s (kind, name, marker) VALUES (?, ?, ?)", markersTableName()),
+		string(kind), name, marker)
+	if err != nil {
+		return fmt.Errorf("failed to set ownership marker: %v", err)
+	}
 	return nil
 }
 
+// ListObjects returns databases and users which can connect from any host (the operator never creates other ones)
+func (server *MySQLServer) ListObjects() ([]ServerObject, error) {
+	connection, err := server.openDatabase()
+	if err != nil {
+		return nil, &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	databases, err := queryObjects(connection, ObjectDatabase, "SELECT schema_name, '' FROM information_schema.schemata "+
+		"WHERE schema_name NOT IN ('mysql', 'information_schema', 'performance_schema', 'sys', ?)", markersSchema)
+	if err != nil {
+		return nil, err
+	}
+	users, err := queryObjects(connection, ObjectUser, "SELECT User, '' FROM mysql.user WHERE Host = '%' AND User <> ?",
+		server.Credentials.User)
+	if err != nil {
+		return nil, err
+	}
+	objects := append(databases, users...)
+
+	tableExists, err := markersTableExists(connection)
+	if err != nil || !tableExists {
+		return objects, err
+	}
+	rows, err := connection.Query(fmt.Sprintf("SELECT kind, name, marker FROM %s", markersTableName()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ownership markers: %v", err)
+	}
+	defer rows.Close()
+	markers := map[ServerObject]string{}
+	for rows.Next() {
+		var object ServerObject
+		var marker string
+		if err := rows.Scan(&object.Kind, &object.Name, &marker); err != nil {
+			return nil, fmt.Errorf("failed to list ownership markers: %v", err)
+		}
+		markers[object] = marker
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list ownership markers: %v", err)
+	}
+
+	for i := range objects {
+		objects[i].Marker = markers[ServerObject{Kind: objects[i].Kind, Name: objects[i].Name}]
+	}
+	return objects, nil
+}
+
+// deleteOwnershipMarker removes the marker of the dropped object (if markers table exists)
+func deleteOwnershipMarker(connection *sql.DB, kind ObjectKind, name string) error {
+	tableExists, err := markersTableExists(connection)
+	if err != nil || !tableExists {
+		return err
+	}
+	_, err = connection.Exec(fmt.Sprintf("DELETE FROM %s WHERE kind = ? AND name = ?", markersTableName()),
+		string(kind), name)
+	if err != nil {
+		return fmt.Errorf("failed to delete ownership marker: %v", err)
+	}
+	return nil
+}
+
+func markersTableExists(connection *sql.DB) (bool, error) {
+	tableExists, err := exists(connection,
+		"SELECT 1 FROM information_schema.tables WHERE table_schema = ? AND table_name = ?", markersSchema, markersTable)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if ownership markers table exists: %v", err)
+	}
+	return tableExists, nil
+}
+
+func markersTableName() string {
+	return mySQLDialect.quoteIdentifier(markersSchema) + "." + mySQLDialect.quoteIdentifier(markersTable)
+}
+
+// account returns quoted account name of the user (the user can connect from any host)
+func account(user string) string {
+	return mySQLDialect.quoteIdentifier(user) + "@`%`"
+}
+
+// grantLevel returns privilege level covering all objects in the database
+func grantLevel(dbName string) string {
+	// _ and % are wildcards in database names of GRANT statements
+	dbName = strings.NewReplacer("_", `\_`, "%", `\%`).Replace(dbName)
+	return mySQLDialect.quoteIdentifier(dbName) + ".*"
+}
+
+// identification returns IDENTIFIED clause of CREATE USER and ALTER USER statements
+func (server *MySQLServer) identification(version *MySQLVersion, password string) string {
+	if server.AuthPlugin == "" || version.Flavour == FlavourMariaDB {
+		// MariaDB uses different syntax for plugins, but mysql_native_password (the only supported one) is its default
+		return fmt.Sprintf("IDENTIFIED BY %s", mySQLDialect.quoteLiteral(password))
+	}
+	return fmt.Sprintf("IDENTIFIED WITH %s BY %s", server.AuthPlugin, mySQLDialect.quoteLiteral(password))
+}
+
+func (server *MySQLServer) GetVersion() (string, error) {
+	connection, err := server.openDatabase()
+	if err != nil {
+		return "", &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	version, err := server.queryVersion(connection)
+	if err != nil {
+		return "", err
+	}
+	return version.String(), nil
+}
+
+func (server *MySQLServer) queryVersion(connection *sql.DB) (*MySQLVersion, error) {
+	var version string
+	if err := connection.QueryRow("SELECT VERSION()").Scan(&version); err != nil {
+		return nil, fmt.Errorf("failed to get server version: %v", err)
+	}
+	return ParseMySQLVersion(version)
+}
+
+func (server *MySQLServer) GetConnectionDetails(dbName string, userCredentials *Credentials) *ConnectionDetails {
+	connectionDetails := newConnectionDetails("mysql", "mysql", server.Host, server.Port, dbName, userCredentials)
+
+	config := mysql.NewConfig()
+	config.User = userCredentials.User
+	config.Passwd = userCredentials.Password
+	config.Net = "tcp"
+	config.Addr = fmt.Sprintf("%v:%v", server.Host, server.Port)
+	config.DBName = dbName
+	connectionDetails.DSN = config.FormatDSN()
+
+	return connectionDetails
+}
+
 func (server *MySQLServer) openDatabase() (*sql.DB, error) {
-	dataSource := fmt.Sprintf("%v:%v@tcp(%v:%v)/", server.Credentials.User, server.Credentials.Password,
-		server.Host, server.Port)
-	return sql.Open("mysql", dataSource)
-}
\ No newline at end of file
+	config := mysql.NewConfig()
+	config.User = server.Credentials.User
+	config.Passwd = server.Credentials.Password
+	config.Net = "tcp"
+	config.Addr = fmt.Sprintf("%v:%v", server.Host, server.Port)
+	// literals are quoted with escaped backslashes, so they must not be disabled in any of the sessions
+	config.Params = map[string]string{"sql_mode": noBackslashEscapesDisabled}
+	connection, err := sql.Open("mysql", config.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	// connection is opened lazily, make sure the server is reachable before running any statements
+	if err := connection.Ping(); err != nil {
+		connection.Close()
+		return nil, err
+	}
+	return connection, nil
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	FlavourMySQL   = "MySQL"
+	FlavourMariaDB = "MariaDB"
+)
+
+var mySQLVersionRegexp = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)`)
+
+// MySQLVersion describes version and flavour of the MySQL compatible server.
+type MySQLVersion struct {
+	Flavour string
+	Major   int
+	Minor   int
+	Patch   int
+}
+
+// ParseMySQLVersion parses version string as returned by SELECT VERSION() (e.g. 8.0.12, 5.7.22-log or
+// 10.3.8-MariaDB-1:10.3.8+maria~jessie).
+func ParseMySQLVersion(version string) (*MySQLVersion, error) {
+	flavour := FlavourMySQL
+	if strings.Contains(version, "MariaDB") {
+		flavour = FlavourMariaDB
+		// MariaDB may prefix its real version with a fake one for the replication compatibility
+		version = strings.TrimPrefix(version, "5.5.5-")
+	}
+
+	match := mySQLVersionRegexp.FindStringSubmatch(version)
+	if match == nil {
+		return nil, fmt.Errorf("unrecognized server version: %v", version)
+	}
+
+	parts := make([]int, 3)
+	for i := range parts {
+		parts[i], _ = strconv.Atoi(match[i+1])
+	}
+	return &MySQLVersion{flavour, parts[0], parts[1], parts[2]}, nil
+}
+
+// AtLeast returns true if the version is greater or equal to the given one.
+func (v *MySQLVersion) AtLeast(major, minor, patch int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	if v.Minor != minor {
+		return v.Minor > minor
+	}
+	return v.Patch >= patch
+}
+
+// SupportsCreateUserIfNotExists returns true if the server supports CREATE USER IF NOT EXISTS statement
+// (MySQL 5.7.6+, MariaDB 10.1.3+).
+func (v *MySQLVersion) SupportsCreateUserIfNotExists() bool {
+	if v.Flavour == FlavourMariaDB {
+		return v.AtLeast(10, 1, 3)
+	}
+	return v.AtLeast(5, 7, 6)
+}
+
+// SupportsAlterUser returns true if the server supports ALTER USER statement changing the password (MySQL 5.7.6+,
+// MariaDB 10.2.0+). Older servers have to use SET PASSWORD.
+func (v *MySQLVersion) SupportsAlterUser() bool {
+	if v.Flavour == FlavourMariaDB {
+		return v.AtLeast(10, 2, 0)
+	}
+	return v.AtLeast(5, 7, 6)
+}
+
+// SupportsDropUserIfExists returns true if the server supports DROP USER IF EXISTS statement (MySQL 5.7.8+,
+// MariaDB 10.1.3+).
+func (v *MySQLVersion) SupportsDropUserIfExists() bool {
+	if v.Flavour == FlavourMariaDB {
+		return v.AtLeast(10, 1, 3)
+	}
+	return v.AtLeast(5, 7, 8)
+}
+
+// SupportsAuthPlugin returns true if users identified with the given authentication plugin can be created.
+func (v *MySQLVersion) SupportsAuthPlugin(plugin string) bool {
+	switch plugin {
+	case "", AuthPluginMySQLNativePassword:
+		return true
+	case AuthPluginCachingSHA2Password:
+		return v.Flavour == FlavourMySQL && v.AtLeast(8, 0, 0)
+	default:
+		return false
+	}
+}
+
+func (v *MySQLVersion) String() string {
+	return fmt.Sprintf("%v %v.%v.%v", v.Flavour, v.Major, v.Minor, v.Patch)
+}
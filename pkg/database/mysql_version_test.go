@@ -0,0 +1,70 @@
+package database
+
+import "testing"
+
+func TestParseMySQLVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    MySQLVersion
+	}{
+		{"8.0.12", MySQLVersion{FlavourMySQL, 8, 0, 12}},
+		{"5.7.22-log", MySQLVersion{FlavourMySQL, 5, 7, 22}},
+		{"5.6.40-84.0", MySQLVersion{FlavourMySQL, 5, 6, 40}},
+		{"10.3.8-MariaDB-1:10.3.8+maria~jessie", MySQLVersion{FlavourMariaDB, 10, 3, 8}},
+		{"5.5.5-10.1.34-MariaDB", MySQLVersion{FlavourMariaDB, 10, 1, 34}},
+	}
+	for _, test := range tests {
+		got, err := ParseMySQLVersion(test.version)
+		if err != nil {
+			t.Errorf("ParseMySQLVersion(%q) returned error: %v", test.version, err)
+			continue
+		}
+		if *got != test.want {
+			t.Errorf("ParseMySQLVersion(%q) = %+v, want %+v", test.version, *got, test.want)
+		}
+	}
+}
+
+func TestParseMySQLVersionInvalid(t *testing.T) {
+	for _, version := range []string{"", "8.0", "MySQL", "v8.0.12"} {
+		if _, err := ParseMySQLVersion(version); err == nil {
+			t.Errorf("ParseMySQLVersion(%q) returned no error", version)
+		}
+	}
+}
+
+func TestMySQLVersionFeatures(t *testing.T) {
+	tests := []struct {
+		version                 MySQLVersion
+		createUserIfNotExists   bool
+		alterUser               bool
+		dropUserIfExists        bool
+		cachingSHA2PasswordAuth bool
+	}{
+		{MySQLVersion{FlavourMySQL, 5, 6, 40}, false, false, false, false},
+		{MySQLVersion{FlavourMySQL, 5, 7, 6}, true, true, false, false},
+		{MySQLVersion{FlavourMySQL, 5, 7, 8}, true, true, true, false},
+		{MySQLVersion{FlavourMySQL, 8, 0, 12}, true, true, true, true},
+		{MySQLVersion{FlavourMariaDB, 10, 0, 35}, false, false, false, false},
+		{MySQLVersion{FlavourMariaDB, 10, 1, 3}, true, false, true, false},
+		{MySQLVersion{FlavourMariaDB, 10, 1, 34}, true, false, true, false},
+		{MySQLVersion{FlavourMariaDB, 10, 2, 0}, true, true, true, false},
+		{MySQLVersion{FlavourMariaDB, 10, 3, 8}, true, true, true, false},
+	}
+	for _, test := range tests {
+		v := test.version
+		if got := v.SupportsCreateUserIfNotExists(); got != test.createUserIfNotExists {
+			t.Errorf("%v: SupportsCreateUserIfNotExists() = %v, want %v", &v, got, test.createUserIfNotExists)
+		}
+		if got := v.SupportsAlterUser(); got != test.alterUser {
+			t.Errorf("%v: SupportsAlterUser() = %v, want %v", &v, got, test.alterUser)
+		}
+		if got := v.SupportsDropUserIfExists(); got != test.dropUserIfExists {
+			t.Errorf("%v: SupportsDropUserIfExists() = %v, want %v", &v, got, test.dropUserIfExists)
+		}
+		if got := v.SupportsAuthPlugin(AuthPluginCachingSHA2Password); got != test.cachingSHA2PasswordAuth {
+			t.Errorf("%v: SupportsAuthPlugin(%v) = %v, want %v", &v, AuthPluginCachingSHA2Password, got,
+				test.cachingSHA2PasswordAuth)
+		}
+	}
+}
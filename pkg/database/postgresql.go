@@ -0,0 +1,447 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// maintenanceDb is the database used for the connection when managing other databases
+const maintenanceDb = "postgres"
+
+// PostgreSQLSSLModes defines supported values of sslmode connection parameter
+var PostgreSQLSSLModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+type PostgreSQLServer struct {
+	Host        string
+	Port        int32
+	Credentials *Credentials
+	// SSL mode of the connections (disable if empty), it's also used in the published connection details
+	SSLMode string
+}
+
+// CreateDatabase creates the database owned by the given role (the role is created without login privilege if it
+// doesn't exist yet, CreateUser can be used to allow it to log in).
+func (server *PostgreSQLServer) CreateDatabase(dbName string, owner string) error {
+	if err := postgreSQLDialect.validateDatabaseName(dbName); err != nil {
+		return err
+	}
+	if err := postgreSQLDialect.validateUserName(owner); err != nil {
+		return err
+	}
+	database := postgreSQLDialect.quoteIdentifier(dbName)
+	role := postgreSQLDialect.quoteIdentifier(owner)
+
+	connection, err := server.openDatabase(maintenanceDb)
+	if err != nil {
+		return &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	roleExists, err := exists(connection, "SELECT 1 FROM pg_roles WHERE rolname = $1", owner)
+	if err != nil {
+		return fmt.Errorf("failed to check if user exists: %v", err)
+	}
+	if !roleExists {
+		_, err = connection.Exec(fmt.Sprintf("CREATE ROLE %s NOLOGIN", role))
+		if err != nil {
+			return fmt.Errorf("failed to create user: %v", err)
+		}
+	}
+
+	// the root user must be a member of the role to be able to assign database ownership to it
+	// (a no-op when the root user is a superuser)
+	_, err = connection.Exec(fmt.Sprintf("GRANT %s TO CURRENT_USER", role))
+	if err != nil {
+		return fmt.Errorf("failed to grant user role: %v", err)
+	}
+
+	dbExists, err := exists(connection, "SELECT 1 FROM pg_database WHERE datname = $1", dbName)
+	if err != nil {
+		return fmt.Errorf("failed to check if database exists: %v", err)
+	}
+	if dbExists {
+		_, err = connection.Exec(fmt.Sprintf("ALTER DATABASE %s OWNER TO %s", database, role))
+	} else {
+		_, err = connection.Exec(fmt.Sprintf("CREATE DATABASE %s OWNER %s", database, role))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create database: %v", err)
+	}
+
+	return nil
+}
+
+func (server *PostgreSQLServer) DeleteDatabase(dbName string) error {
+	if err := postgreSQLDialect.validateDatabaseName(dbName); err != nil {
+		return err
+	}
+	database := postgreSQLDialect.quoteIdentifier(dbName)
+
+	connection, err := server.openDatabase(maintenanceDb)
+	if err != nil {
+		return &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	dbExists, err := exists(connection, "SELECT 1 FROM pg_database WHERE datname = $1", dbName)
+	if err != nil {
+		return fmt.Errorf("failed to check if database exists: %v", err)
+	}
+	if !dbExists {
+		return nil
+	}
+
+	// prevent new connections before terminating the open ones, otherwise DROP DATABASE may fail
+	// (owner can still connect, but its sessions are terminated as well)
+	_, err = connection.Exec(fmt.Sprintf("REVOKE CONNECT ON DATABASE %s FROM PUBLIC", database))
+	if err != nil {
+		return fmt.Errorf("failed to revoke privileges: %v", err)
+	}
+
+	_, err = connection.Exec("SELECT pg_terminate_backend(pid) FROM pg_stat_activity "+
+		"WHERE datname = $1 AND pid <> pg_backend_pid()", dbName)
+	if err != nil {
+		return fmt.Errorf("failed to terminate database sessions: %v", err)
+	}
+
+	_, err = connection.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s", database))
+	if err != nil {
+		return fmt.Errorf("failed to delete database: %v", err)
+	}
+
+	return nil
+}
+
+// CreateUser creates the user (or updates its password). The user is either the database owner or becomes member
+// of the owner role (objects created by the user are owned by the owner role, so they are shared by all its
+// members). The owner role is taken from the spec, never from the server (the database might have been assigned to
+// another role in the meantime).
+func (server *PostgreSQLServer) CreateUser(dbName string, owner string, userCredentials *Credentials) error {
+	if err := postgreSQLDialect.validateDatabaseName(dbName); err != nil {
+		return err
+	}
+	if err := postgreSQLDialect.validateUserName(owner); err != nil {
+		return err
+	}
+	if err := postgreSQLDialect.validateCredentials(userCredentials); err != nil {
+		return err
+	}
+	user := postgreSQLDialect.quoteIdentifier(userCredentials.User)
+	password := postgreSQLDialect.quoteLiteral(userCredentials.Password)
+
+	connection, err := server.openDatabase(maintenanceDb)
+	if err != nil {
+		return &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	userExists, err := exists(connection, "SELECT 1 FROM pg_roles WHERE rolname = $1", userCredentials.User)
+	if err != nil {
+		return fmt.Errorf("failed to check if user exists: %v", err)
+	}
+	if userExists {
+		_, err = connection.Exec(fmt.Sprintf("ALTER ROLE %s WITH LOGIN PASSWORD %s", user, password))
+	} else {
+		_, err = connection.Exec(fmt.Sprintf("CREATE ROLE %s LOGIN PASSWORD %s", user, password))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create user: %v", err)
+	}
+
+	if owner == userCredentials.User {
+		return nil
+	}
+
+	var ownerIsSuperuser bool
+	err = connection.QueryRow("SELECT rolsuper FROM pg_roles WHERE rolname = $1", owner).Scan(&ownerIsSuperuser)
+	if err != nil {
+		return fmt.Errorf("failed to get owner role: %v", err)
+	}
+	if ownerIsSuperuser {
+		return &ValidationError{
+			Reason:  ReasonInvalidUserName,
+			Message: fmt.Sprintf("owner role %v is a superuser and can't be granted", owner),
+		}
+	}
+
+	ownerRole := postgreSQLDialect.quoteIdentifier(owner)
+	_, err = connection.Exec(fmt.Sprintf("GRANT %s TO %s", ownerRole, user))
+	if err != nil {
+		return fmt.Errorf("failed to grant privileges: %v", err)
+	}
+
+	_, err = connection.Exec(fmt.Sprintf("ALTER ROLE %s SET ROLE %s", user, ownerRole))
+	if err != nil {
+		return fmt.Errorf("failed to set default role: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteUser drops the user. Objects in the database owned by the user (e.g. created before the database owner has
+// been changed) are reassigned to the database owner first (dbName may be empty if the database is unknown).
+func (server *PostgreSQLServer) DeleteUser(dbName string, user string) error {
+	if dbName != "" {
+		if err := postgreSQLDialect.validateDatabaseName(dbName); err != nil {
+			return err
+		}
+	}
+	if err := postgreSQLDialect.validateUserName(user); err != nil {
+		return err
+	}
+
+	connection, err := server.openDatabase(maintenanceDb)
+	if err != nil {
+		return &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	var owner string
+	err = connection.QueryRow("SELECT pg_get_userbyid(datdba) FROM pg_database WHERE datname = $1", dbName).Scan(&owner)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get database owner: %v", err)
+	}
+	userExists, err := exists(connection, "SELECT 1 FROM pg_roles WHERE rolname = $1", user)
+	if err != nil {
+		return fmt.Errorf("failed to check if user exists: %v", err)
+	}
+	if owner != "" && userExists {
+		newOwner := owner
+		if owner == user {
+			// the database is kept (e.g. only users are dropped on delete), so it's taken over by the root user
+			newOwner = server.Credentials.User
+		}
+		if err := server.reassignOwned(dbName, user, newOwner); err != nil {
+			return err
+		}
+	}
+
+	_, err = connection.Exec("SELECT pg_terminate_backend(pid) FROM pg_stat_activity "+
+		"WHERE usename = $1 AND pid <> pg_backend_pid()", user)
+	if err != nil {
+		return fmt.Errorf("failed to terminate user sessions: %v", err)
+	}
+
+	_, err = connection.Exec(fmt.Sprintf("DROP ROLE IF EXISTS %s", postgreSQLDialect.quoteIdentifier(user)))
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %v", err)
+	}
+
+	return nil
+}
+
+// GetDatabaseState checks if the database owned by the given role and the user (the owner or member of the owner
+// role) exist
+func (server *PostgreSQLServer) GetDatabaseState(dbName string, owner string, user string) (*DatabaseState, error) {
+	connection, err := server.openDatabase(maintenanceDb)
+	if err != nil {
+		return nil, &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	state := &DatabaseState{}
+	var dbOwner string
+	err = connection.QueryRow("SELECT pg_get_userbyid(datdba) FROM pg_database WHERE datname = $1", dbName).Scan(&dbOwner)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, fmt.Errorf("failed to check if database exists: %v", err)
+	default:
+		state.DatabaseExists = true
+		state.OwnerAssigned = dbOwner == owner
+	}
+
+	state.UserExists, err = exists(connection, "SELECT 1 FROM pg_roles WHERE rolname = $1 AND rolcanlogin", user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if user exists: %v", err)
+	}
+
+	if !state.OwnerAssigned || !state.UserExists {
+		return state, nil
+	}
+	if user == owner {
+		state.PrivilegesGranted = true
+		return state, nil
+	}
+	state.PrivilegesGranted, err = exists(connection, "SELECT 1 WHERE pg_has_role($1, $2, 'MEMBER')", user, owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check user privileges: %v", err)
+	}
+	return state, nil
+}
+
+// reassignOwned transfers objects in the database owned by the user to the new owner (REASSIGN OWNED works only
+// in the current database, so a separate connection is needed)
+func (server *PostgreSQLServer) reassignOwned(dbName string, user string, newOwner string) error {
+	connection, err := server.openDatabase(dbName)
+	if err != nil {
+		return &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	_, err = connection.Exec(fmt.Sprintf("REASSIGN OWNED BY %s TO %s", postgreSQLDialect.quoteIdentifier(user),
+		postgreSQLDialect.quoteIdentifier(newOwner)))
+	if err != nil {
+		return fmt.Errorf("failed to reassign objects owned by user: %v", err)
+	}
+
+	// remove remaining privileges, otherwise the role can't be dropped
+	_, err = connection.Exec(fmt.Sprintf("DROP OWNED BY %s", postgreSQLDialect.quoteIdentifier(user)))
+	if err != nil {
+		return fmt.Errorf("failed to revoke user privileges: %v", err)
+	}
+
+	return nil
+}
+
+// ownershipMarkerQueries return comment of the database or role (markers are stored as comments), no rows are
+// returned if the object doesn't exist
+var ownershipMarkerQueries = map[ObjectKind]string{
+	ObjectDatabase: "SELECT shobj_description(oid, 'pg_database') FROM pg_database WHERE datname = $1",
+	ObjectUser:     "SELECT shobj_description(oid, 'pg_authid') FROM pg_roles WHERE rolname = $1",
+}
+
+func (server *PostgreSQLServer) GetOwnershipMarker(kind ObjectKind, name string) (bool, string, error) {
+	query, ok := ownershipMarkerQueries[kind]
+	if !ok {
+		return false, "", fmt.Errorf("unsupported object kind: %v", kind)
+	}
+
+	connection, err := server.openDatabase(maintenanceDb)
+	if err != nil {
+		return false, "", &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	var marker sql.NullString
+	if err := connection.QueryRow(query, name).Scan(&marker); err != nil {
+		if err == sql.ErrNoRows {
+			return false, "", nil
+		}
+		return false, "", fmt.Errorf("failed to get ownership marker: %v", err)
+	}
+	return true, marker.String, nil
+}
+
+// SetOwnershipMarker sets comment of the database or role (it's a no-op if the object doesn't exist yet)
+func (server *PostgreSQLServer) SetOwnershipMarker(kind ObjectKind, name string, marker string) error {
+	objectExists, _, err := server.GetOwnershipMarker(kind, name)
+	if err != nil || !objectExists {
+		return err
+	}
+
+	connection, err := server.openDatabase(maintenanceDb)
+	if err != nil {
+		return &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	objectType := "DATABASE"
+	if kind == ObjectUser {
+		objectType = "ROLE"
+	}
+	_, err = connection.Exec(fmt.Sprintf("COMMENT ON %s %s IS %s", objectType, postgreSQLDialect.quoteIdentifier(name),
+		postgreSQLDialect.quoteLiteral(marker)))
+	if err != nil {
+		return fmt.Errorf("failed to set ownership marker: %v", err)
+	}
+	return nil
+}
+
+// ListObjects returns databases (except the maintenance one) and roles (except the built-in ones, superusers and
+// the root user)
+func (server *PostgreSQLServer) ListObjects() ([]ServerObject, error) {
+	connection, err := server.openDatabase(maintenanceDb)
+	if err != nil {
+		return nil, &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	databases, err := queryObjects(connection, ObjectDatabase, "SELECT datname, shobj_description(oid, 'pg_database') "+
+		"FROM pg_database WHERE NOT datistemplate AND datname <> $1", maintenanceDb)
+	if err != nil {
+		return nil, err
+	}
+	users, err := queryObjects(connection, ObjectUser, "SELECT rolname, shobj_description(oid, 'pg_authid') "+
+		"FROM pg_roles WHERE rolname !~ '^pg_' AND NOT rolsuper AND rolname <> current_user")
+	if err != nil {
+		return nil, err
+	}
+	return append(databases, users...), nil
+}
+
+func (server *PostgreSQLServer) UpdateUserPassword(userCredentials *Credentials) error {
+	if err := postgreSQLDialect.validateCredentials(userCredentials); err != nil {
+		return err
+	}
+
+	connection, err := server.openDatabase(maintenanceDb)
+	if err != nil {
+		return &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	_, err = connection.Exec(fmt.Sprintf("ALTER ROLE %s WITH PASSWORD %s",
+		postgreSQLDialect.quoteIdentifier(userCredentials.User), postgreSQLDialect.quoteLiteral(userCredentials.Password)))
+	if err != nil {
+		return fmt.Errorf("failed to update user: %v", err)
+	}
+
+	return nil
+}
+
+func (server *PostgreSQLServer) GetVersion() (string, error) {
+	connection, err := server.openDatabase(maintenanceDb)
+	if err != nil {
+		return "", &ConnectionError{err}
+	}
+	defer connection.Close()
+
+	var version string
+	if err := connection.QueryRow("SHOW server_version").Scan(&version); err != nil {
+		return "", fmt.Errorf("failed to get server version: %v", err)
+	}
+	// skip build details (e.g. 10.4 (Debian 10.4-2.pgdg90+1))
+	return "PostgreSQL " + strings.SplitN(version, " ", 2)[0], nil
+}
+
+func (server *PostgreSQLServer) GetConnectionDetails(dbName string, userCredentials *Credentials) *ConnectionDetails {
+	connectionDetails := newConnectionDetails("postgres", "postgresql", server.Host, server.Port, dbName, userCredentials)
+	// the same SSL mode as used by the operator
+	connectionDetails.URI += "?sslmode=" + server.sslMode()
+	connectionDetails.DSN = connectionDetails.URI
+	if server.sslMode() != "disable" {
+		// JDBC driver doesn't use SSL unless it's requested
+		connectionDetails.JDBCURL += "?sslmode=" + server.sslMode()
+	}
+	return connectionDetails
+}
+
+func (server *PostgreSQLServer) sslMode() string {
+	if server.SSLMode == "" {
+		return "disable"
+	}
+	return server.SSLMode
+}
+
+func (server *PostgreSQLServer) openDatabase(dbName string) (*sql.DB, error) {
+	dataSource := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(server.Credentials.User, server.Credentials.Password),
+		Host:     fmt.Sprintf("%v:%v", server.Host, server.Port),
+		Path:     "/" + dbName,
+		RawQuery: "sslmode=" + server.sslMode(),
+	}
+	connection, err := sql.Open("postgres", dataSource.String())
+	if err != nil {
+		return nil, err
+	}
+	// connection is opened lazily, make sure the server is reachable before running any statements
+	if err := connection.Ping(); err != nil {
+		connection.Close()
+		return nil, err
+	}
+	return connection, nil
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	ReasonInvalidDatabaseName   = "InvalidDatabaseName"
+	ReasonInvalidUserName       = "InvalidUserName"
+	ReasonInvalidPassword       = "InvalidPassword"
+	ReasonUnsupportedAuthPlugin = "UnsupportedAuthPlugin"
+)
+
+// ValidationError is returned when the requested object can't be created on the target database server
+// (e.g. its name is too long). Such errors are not caused by the server itself, so retrying won't help.
+type ValidationError struct {
+	// Short, machine readable reason (e.g. InvalidDatabaseName)
+	Reason string
+	// Human readable description
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func newValidationError(reason string, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{reason, fmt.Sprintf(format, args...)}
+}
+
+// dialect defines naming rules and quoting of the SQL engine. All names and values inserted into the generated
+// SQL statements must be validated and quoted using the dialect of the target server.
+type dialect struct {
+	name                  string
+	maxDatabaseNameLength int
+	maxUserNameLength     int
+	// identifiers are limited to the Basic Multilingual Plane (U+0001 - U+FFFF)
+	bmpOnly bool
+	// database names can't end with space
+	noTrailingSpace bool
+	// returns length of the identifier, as counted by the engine
+	identifierLength func(string) int
+	quoteIdentifier  func(string) string
+	quoteLiteral     func(string) string
+}
+
+var mySQLDialect = &dialect{
+	name:                  "mysql",
+	maxDatabaseNameLength: 64,
+	maxUserNameLength:     32,
+	bmpOnly:               true,
+	noTrailingSpace:       true,
+	identifierLength:      utf8.RuneCountInString,
+	quoteIdentifier: func(identifier string) string {
+		return "`" + strings.Replace(identifier, "`", "``", -1) + "`"
+	},
+	quoteLiteral: func(literal string) string {
+		// NO_BACKSLASH_ESCAPES sql mode is disabled in the operator sessions (see MySQLServer.openDatabase)
+		literal = strings.Replace(literal, `\`, `\\`, -1)
+		return "'" + strings.Replace(literal, "'", "''", -1) + "'"
+	},
+}
+
+var postgreSQLDialect = &dialect{
+	name:                  "postgresql",
+	maxDatabaseNameLength: 63,
+	maxUserNameLength:     63,
+	identifierLength: func(identifier string) int {
+		return len(identifier)
+	},
+	quoteIdentifier: func(identifier string) string {
+		return `"` + strings.Replace(identifier, `"`, `""`, -1) + `"`
+	},
+	quoteLiteral: func(literal string) string {
+		literal = strings.Replace(literal, "'", "''", -1)
+		if strings.Contains(literal, `\`) {
+			// escape string syntax works regardless of standard_conforming_strings setting
+			return `E'` + strings.Replace(literal, `\`, `\\`, -1) + `'`
+		}
+		return "'" + literal + "'"
+	},
+}
+
+// validateDatabaseName checks if the database name is allowed by the engine
+func (d *dialect) validateDatabaseName(dbName string) error {
+	if err := d.validateIdentifier(dbName, d.maxDatabaseNameLength); err != nil {
+		return newValidationError(ReasonInvalidDatabaseName, "invalid database name %q: %v", dbName, err)
+	}
+	if d.noTrailingSpace && strings.HasSuffix(dbName, " ") {
+		return newValidationError(ReasonInvalidDatabaseName, "invalid database name %q: must not end with space", dbName)
+	}
+	return nil
+}
+
+// validateUserName checks if the user name is allowed by the engine
+func (d *dialect) validateUserName(user string) error {
+	if err := d.validateIdentifier(user, d.maxUserNameLength); err != nil {
+		return newValidationError(ReasonInvalidUserName, "invalid user name %q: %v", user, err)
+	}
+	return nil
+}
+
+// validateCredentials checks if the user name and password are allowed by the engine
+func (d *dialect) validateCredentials(credentials *Credentials) error {
+	if err := d.validateUserName(credentials.User); err != nil {
+		return err
+	}
+	if credentials.Password == "" {
+		return newValidationError(ReasonInvalidPassword, "invalid password for user %q: must not be empty", credentials.User)
+	}
+	if !utf8.ValidString(credentials.Password) || strings.ContainsRune(credentials.Password, 0) {
+		return newValidationError(ReasonInvalidPassword,
+			"invalid password for user %q: must be a valid UTF-8 string without NUL characters", credentials.User)
+	}
+	return nil
+}
+
+func (d *dialect) validateIdentifier(identifier string, maxLength int) error {
+	if identifier == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	if !utf8.ValidString(identifier) {
+		return fmt.Errorf("must be a valid UTF-8 string")
+	}
+	if length := d.identifierLength(identifier); length > maxLength {
+		return fmt.Errorf("too long (%v limit is %v, got %v)", d.name, maxLength, length)
+	}
+	for _, r := range identifier {
+		if r == 0 {
+			return fmt.Errorf("must not contain NUL characters")
+		}
+		if d.bmpOnly && r > 0xFFFF {
+			return fmt.Errorf("must not contain supplementary characters (U+10000 and higher)")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		dialect    *dialect
+		identifier string
+		want       string
+	}{
+		{mySQLDialect, "app", "`app`"},
+		{mySQLDialect, "my app", "`my app`"},
+		{mySQLDialect, "a`b", "`a``b`"},
+		{mySQLDialect, "a``b", "`a````b`"},
+		{mySQLDialect, `a"b'c\d`, "`a\"b'c\\d`"},
+		{mySQLDialect, "`; DROP DATABASE x; --", "```; DROP DATABASE x; --`"},
+		{postgreSQLDialect, "app", `"app"`},
+		{postgreSQLDialect, "App", `"App"`},
+		{postgreSQLDialect, `a"b`, `"a""b"`},
+		{postgreSQLDialect, "a`b'c\\d", "\"a`b'c\\d\""},
+		{postgreSQLDialect, `"; DROP DATABASE x; --`, `"""; DROP DATABASE x; --"`},
+	}
+	for _, test := range tests {
+		if got := test.dialect.quoteIdentifier(test.identifier); got != test.want {
+			t.Errorf("%v: quoteIdentifier(%q) = %q, want %q", test.dialect.name, test.identifier, got, test.want)
+		}
+	}
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	tests := []struct {
+		dialect *dialect
+		literal string
+		want    string
+	}{
+		{mySQLDialect, "secret", `'secret'`},
+		{mySQLDialect, "it's", `'it''s'`},
+		{mySQLDialect, `a\b`, `'a\\b'`},
+		{mySQLDialect, `a\'b`, `'a\\''b'`},
+		{mySQLDialect, `\`, `'\\'`},
+		{mySQLDialect, `'; DROP USER root; --`, `'''; DROP USER root; --'`},
+		{postgreSQLDialect, "secret", `'secret'`},
+		{postgreSQLDialect, "it's", `'it''s'`},
+		{postgreSQLDialect, `a\b`, `E'a\\b'`},
+		{postgreSQLDialect, `a\'b`, `E'a\\''b'`},
+		{postgreSQLDialect, `\`, `E'\\'`},
+		{postgreSQLDialect, `'; DROP ROLE postgres; --`, `'''; DROP ROLE postgres; --'`},
+	}
+	for _, test := range tests {
+		if got := test.dialect.quoteLiteral(test.literal); got != test.want {
+			t.Errorf("%v: quoteLiteral(%q) = %q, want %q", test.dialect.name, test.literal, got, test.want)
+		}
+	}
+}
+
+func TestValidateDatabaseName(t *testing.T) {
+	tests := []struct {
+		dialect *dialect
+		dbName  string
+		valid   bool
+	}{
+		{mySQLDialect, "app", true},
+		{mySQLDialect, "my-app db", true},
+		{mySQLDialect, "zażółć", true},
+		{mySQLDialect, strings.Repeat("a", 64), true},
+		{mySQLDialect, strings.Repeat("ą", 64), true},
+		{mySQLDialect, strings.Repeat("a", 65), false},
+		{mySQLDialect, "", false},
+		{mySQLDialect, "app ", false},
+		{mySQLDialect, "a\x00b", false},
+		{mySQLDialect, "\xff", false},
+		{mySQLDialect, "app😀", false},
+		{postgreSQLDialect, "app", true},
+		{postgreSQLDialect, "app ", true},
+		{postgreSQLDialect, "app😀", true},
+		{postgreSQLDialect, strings.Repeat("a", 63), true},
+		{postgreSQLDialect, strings.Repeat("a", 64), false},
+		// length is counted in bytes
+		{postgreSQLDialect, strings.Repeat("ą", 32), false},
+		{postgreSQLDialect, "", false},
+		{postgreSQLDialect, "a\x00b", false},
+		{postgreSQLDialect, "\xff", false},
+	}
+	for _, test := range tests {
+		err := test.dialect.validateDatabaseName(test.dbName)
+		if (err == nil) != test.valid {
+			t.Errorf("%v: validateDatabaseName(%q) = %v, want valid: %v", test.dialect.name, test.dbName, err,
+				test.valid)
+		}
+		if err != nil && err.(*ValidationError).Reason != ReasonInvalidDatabaseName {
+			t.Errorf("%v: validateDatabaseName(%q) reason = %v", test.dialect.name, test.dbName,
+				err.(*ValidationError).Reason)
+		}
+	}
+}
+
+func TestValidateUserName(t *testing.T) {
+	tests := []struct {
+		dialect *dialect
+		user    string
+		valid   bool
+	}{
+		{mySQLDialect, "app_user", true},
+		{mySQLDialect, "app user ", true},
+		{mySQLDialect, strings.Repeat("a", 32), true},
+		{mySQLDialect, strings.Repeat("a", 33), false},
+		{mySQLDialect, "", false},
+		{mySQLDialect, "a\x00b", false},
+		{mySQLDialect, "user😀", false},
+		{postgreSQLDialect, "app_user", true},
+		{postgreSQLDialect, strings.Repeat("a", 63), true},
+		{postgreSQLDialect, strings.Repeat("a", 64), false},
+		{postgreSQLDialect, "", false},
+		{postgreSQLDialect, "\xff", false},
+	}
+	for _, test := range tests {
+		err := test.dialect.validateUserName(test.user)
+		if (err == nil) != test.valid {
+			t.Errorf("%v: validateUserName(%q) = %v, want valid: %v", test.dialect.name, test.user, err, test.valid)
+		}
+		if err != nil && err.(*ValidationError).Reason != ReasonInvalidUserName {
+			t.Errorf("%v: validateUserName(%q) reason = %v", test.dialect.name, test.user,
+				err.(*ValidationError).Reason)
+		}
+	}
+}
+
+func TestValidateCredentials(t *testing.T) {
+	tests := []struct {
+		credentials Credentials
+		valid       bool
+		reason      string
+	}{
+		{Credentials{User: "app", Password: "secret"}, true, ""},
+		{Credentials{User: "app", Password: `'"\; --`}, true, ""},
+		{Credentials{User: "app", Password: "zażółć😀"}, true, ""},
+		{Credentials{User: "app", Password: ""}, false, ReasonInvalidPassword},
+		{Credentials{User: "app", Password: "a\x00b"}, false, ReasonInvalidPassword},
+		{Credentials{User: "app", Password: "\xff"}, false, ReasonInvalidPassword},
+		{Credentials{User: "", Password: "secret"}, false, ReasonInvalidUserName},
+	}
+	for _, d := range []*dialect{mySQLDialect, postgreSQLDialect} {
+		for _, test := range tests {
+			credentials := test.credentials
+			err := d.validateCredentials(&credentials)
+			if (err == nil) != test.valid {
+				t.Errorf("%v: validateCredentials(%+v) = %v, want valid: %v", d.name, credentials, err, test.valid)
+				continue
+			}
+			if err != nil && err.(*ValidationError).Reason != test.reason {
+				t.Errorf("%v: validateCredentials(%+v) reason = %v, want %v", d.name, credentials,
+					err.(*ValidationError).Reason, test.reason)
+			}
+		}
+	}
+}
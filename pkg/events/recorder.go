@@ -0,0 +1,95 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxCachedEvents limits number of events remembered for aggregation
+const maxCachedEvents = 4096
+
+// Recorder creates Events attached to the given objects. Repeated events (the same object, type, reason and
+// message) are aggregated into a single Event with increasing count, similarly to the client-go recorder.
+type Recorder struct {
+	component string
+
+	// guards events only, it's never held during API calls
+	mutex sync.Mutex
+	// last Event created for the given key
+	events map[string]*v1.Event
+}
+
+// NewRecorder returns new Recorder reporting events from the given component (e.g. database-k8s-operator)
+func NewRecorder(component string) *Recorder {
+	return &Recorder{
+		component: component,
+		events:    map[string]*v1.Event{},
+	}
+}
+
+// Event records an event of the given type (Normal or Warning) attached to the object
+func (r *Recorder) Event(object *v1.ObjectReference, eventType string, reason string, message string) error {
+	key := fmt.Sprintf("%v/%v/%v/%v", object.UID, eventType, reason, message)
+	now := metav1.Now()
+
+	if event := r.cachedEvent(key); event != nil {
+		updated := event.DeepCopy()
+		updated.Count++
+		updated.LastTimestamp = now
+		if err := sdk.Update(updated); err == nil {
+			r.cacheEvent(key, updated)
+			return nil
+		}
+		// the event might have expired (or has been updated concurrently), create a new one
+	}
+
+	event := &v1.Event{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Event",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%v.%x", object.Name, time.Now().UnixNano()),
+			Namespace: object.Namespace,
+		},
+		InvolvedObject: *object,
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Source: v1.EventSource{
+			Component: r.component,
+		},
+	}
+	if event.Namespace == "" {
+		// events of cluster-scoped objects are stored in the default namespace
+		event.Namespace = metav1.NamespaceDefault
+	}
+	if err := sdk.Create(event); err != nil {
+		return fmt.Errorf("failed to create event: %v", err)
+	}
+	r.cacheEvent(key, event)
+	return nil
+}
+
+func (r *Recorder) cachedEvent(key string) *v1.Event {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.events[key]
+}
+
+func (r *Recorder) cacheEvent(key string, event *v1.Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.events[key]; !ok && len(r.events) >= maxCachedEvents {
+		r.events = map[string]*v1.Event{}
+	}
+	r.events[key] = event
+}
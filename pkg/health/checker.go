@@ -0,0 +1,58 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Check returns an error if the checked component is not healthy
+type Check func() error
+
+// Checker is the HTTP handler reporting results of the registered checks (200 if all of them pass, 503 otherwise).
+type Checker struct {
+	mutex  sync.RWMutex
+	checks map[string]Check
+}
+
+// NewChecker returns Checker without any checks (it always reports success)
+func NewChecker() *Checker {
+	return &Checker{checks: map[string]Check{}}
+}
+
+// AddCheck registers the check with the given name
+func (c *Checker) AddCheck(name string, check Check) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.checks[name] = check
+}
+
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.RLock()
+	names := make([]string, 0, len(c.checks))
+	checks := make(map[string]Check, len(c.checks))
+	for name, check := range c.checks {
+		names = append(names, name)
+		checks[name] = check
+	}
+	c.mutex.RUnlock()
+	sort.Strings(names)
+
+	var failures []string
+	for _, name := range names {
+		if err := checks[name](); err != nil {
+			failures = append(failures, fmt.Sprintf("%v: %v", name, err))
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if len(failures) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		for _, failure := range failures {
+			fmt.Fprintln(w, failure)
+		}
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,217 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jakub-bacic/database-k8s-operator/pkg/logging"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/metrics"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// leaderAnnotation is the ConfigMap annotation holding the leader record (the same as used by client-go, so
+// standard tooling can show the current leader)
+const leaderAnnotation = "control-plane.alpha.kubernetes.io/leader"
+
+// Config defines settings of the leader election.
+type Config struct {
+	// Namespace and name of the ConfigMap used as the lock
+	Namespace string
+	Name      string
+	// Unique identity of the candidate (e.g. pod name)
+	Identity string
+	// Time after which the leadership can be taken over if the leader doesn't renew it
+	LeaseDuration time.Duration
+	// Time for which the leader tries to renew the leadership before giving it up
+	RenewDeadline time.Duration
+	// Interval between attempts to acquire or renew the leadership
+	RetryPeriod time.Duration
+}
+
+// record describes the current leader.
+type record struct {
+	HolderIdentity       string      `json:"holderIdentity"`
+	LeaseDurationSeconds int         `json:"leaseDurationSeconds"`
+	AcquireTime          metav1.Time `json:"acquireTime"`
+	RenewTime            metav1.Time `json:"renewTime"`
+	LeaderTransitions    int         `json:"leaderTransitions"`
+}
+
+// Elector elects the leader among the operator replicas using ConfigMap lock.
+type Elector struct {
+	config Config
+	client kubernetes.Interface
+
+	// last observed record and local time it's been observed at (clocks of the replicas may differ)
+	observedRecord record
+	observedTime   time.Time
+}
+
+// NewElector returns new Elector with the given config
+func NewElector(config Config, client kubernetes.Interface) (*Elector, error) {
+	if config.Namespace == "" || config.Name == "" || config.Identity == "" {
+		return nil, fmt.Errorf("namespace, name and identity of the leader election lock must be set")
+	}
+	if config.RenewDeadline >= config.LeaseDuration || config.RetryPeriod >= config.RenewDeadline {
+		return nil, fmt.Errorf("leader election requires retryPeriod < renewDeadline < leaseDuration")
+	}
+	return &Elector{config: config, client: client}, nil
+}
+
+// Run waits for the leadership and runs onStartedLeading once it's acquired. The leadership is renewed until it's
+// lost, then onStoppedLeading is called and Run returns. It also returns if the context is cancelled.
+func (e *Elector) Run(ctx context.Context, onStartedLeading func(ctx context.Context), onStoppedLeading func()) {
+	logger := logging.GetLogger(ctx)
+
+	logger.Infof("Waiting for leadership (lock: %v/%v, identity: %v)", e.config.Namespace, e.config.Name,
+		e.config.Identity)
+	if !e.acquire(ctx) {
+		return
+	}
+	logger.Infof("Leadership acquired")
+	metrics.Leader.Set(1)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go onStartedLeading(leaderCtx)
+
+	e.renew(ctx)
+	metrics.Leader.Set(0)
+	logger.Warnf("Leadership lost")
+	onStoppedLeading()
+}
+
+// acquire tries to acquire the leadership until it succeeds or the context is cancelled
+func (e *Elector) acquire(ctx context.Context) bool {
+	for {
+		if e.tryAcquireOrRenew(ctx) {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(e.config.RetryPeriod):
+		}
+	}
+}
+
+// renew renews the leadership until it fails for longer than the renew deadline or the context is cancelled
+func (e *Elector) renew(ctx context.Context) {
+	lastRenew := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.config.RetryPeriod):
+		}
+
+		if e.tryAcquireOrRenew(ctx) {
+			lastRenew = time.Now()
+		} else if time.Since(lastRenew) > e.config.RenewDeadline {
+			return
+		}
+	}
+}
+
+// tryAcquireOrRenew acquires the leadership (if it's not held by other replica) or renews it and returns true
+// on success
+func (e *Elector) tryAcquireOrRenew(ctx context.Context) bool {
+	logger := logging.GetLogger(ctx)
+	configMaps := e.client.CoreV1().ConfigMaps(e.config.Namespace)
+
+	now := metav1.Now()
+	desired := record{
+		HolderIdentity:       e.config.Identity,
+		LeaseDurationSeconds: int(e.config.LeaseDuration / time.Second),
+		AcquireTime:          now,
+		RenewTime:            now,
+	}
+
+	configMap, err := configMaps.Get(e.config.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		configMap = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: e.config.Namespace,
+				Name:      e.config.Name,
+			},
+		}
+		if err := setRecord(configMap, desired); err != nil {
+			logger.Errorf("failed to create leader election lock: %v", err)
+			return false
+		}
+		if _, err := configMaps.Create(configMap); err != nil {
+			logger.Errorf("failed to create leader election lock: %v", err)
+			return false
+		}
+		e.observe(ctx, desired)
+		return true
+	}
+	if err != nil {
+		logger.Errorf("failed to get leader election lock: %v", err)
+		return false
+	}
+
+	var current record
+	if value := configMap.Annotations[leaderAnnotation]; value != "" {
+		if err := json.Unmarshal([]byte(value), &current); err != nil {
+			logger.Errorf("failed to parse leader election record: %v", err)
+			return false
+		}
+	}
+	e.observe(ctx, current)
+
+	if current.HolderIdentity != "" && current.HolderIdentity != e.config.Identity &&
+		time.Since(e.observedTime) < time.Duration(current.LeaseDurationSeconds)*time.Second {
+		// held by other replica
+		return false
+	}
+
+	if current.HolderIdentity == e.config.Identity {
+		desired.AcquireTime = current.AcquireTime
+		desired.LeaderTransitions = current.LeaderTransitions
+	} else {
+		desired.LeaderTransitions = current.LeaderTransitions + 1
+	}
+
+	if err := setRecord(configMap, desired); err != nil {
+		logger.Errorf("failed to update leader election lock: %v", err)
+		return false
+	}
+	// update fails on conflict if other replica has changed the lock in the meantime
+	if _, err := configMaps.Update(configMap); err != nil {
+		logger.Errorf("failed to update leader election lock: %v", err)
+		return false
+	}
+	e.observe(ctx, desired)
+	return true
+}
+
+// observe remembers the record and reports leadership changes
+func (e *Elector) observe(ctx context.Context, current record) {
+	if current == e.observedRecord {
+		return
+	}
+	if current.HolderIdentity != e.observedRecord.HolderIdentity {
+		logging.GetLogger(ctx).Infof("New leader elected: %v", current.HolderIdentity)
+		metrics.LeaderChanges.Inc()
+	}
+	e.observedRecord = current
+	e.observedTime = time.Now()
+}
+
+func setRecord(configMap *v1.ConfigMap, value record) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if configMap.Annotations == nil {
+		configMap.Annotations = map[string]string{}
+	}
+	configMap.Annotations[leaderAnnotation] = string(data)
+	return nil
+}
@@ -2,6 +2,7 @@ package logging
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/sirupsen/logrus"
 )
@@ -39,3 +40,27 @@ func GetLogger(ctx context.Context) *Logger {
 func NewContext(ctx context.Context, fields Fields) context.Context {
 	return context.WithValue(ctx, loggerKey, GetLogger(ctx).WithFields(fields))
 }
+
+// Configure sets level (e.g. info) and format (text or json) of the logs, including logs of operator-sdk
+func Configure(level string, format string) error {
+	parsedLevel, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	var formatter logrus.Formatter
+	switch format {
+	case "text":
+		formatter = &logrus.TextFormatter{}
+	case "json":
+		formatter = &logrus.JSONFormatter{}
+	default:
+		return fmt.Errorf("unsupported log format: %v", format)
+	}
+
+	logger.Logger.SetLevel(parsedLevel)
+	logger.Logger.Formatter = formatter
+	logrus.SetLevel(parsedLevel)
+	logrus.SetFormatter(formatter)
+	return nil
+}
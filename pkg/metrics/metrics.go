@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// namespace is the prefix of all metrics exposed by the operator
+const namespace = "database_k8s_operator"
+
+const (
+	// ResultSuccess and ResultError are values of the result label
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+var (
+	// Leader is set to 1 when the replica is the leader
+	Leader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leader",
+		Help:      "Whether the operator replica is the leader (1) or not (0).",
+	})
+	// LeaderChanges counts leadership changes observed by the replica
+	LeaderChanges = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "leader_changes_total",
+		Help:      "Number of leadership changes observed by the operator replica.",
+	})
+
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_total",
+		Help:      "Number of handled events per resource kind and result.",
+	}, []string{"kind", "result"})
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Duration of event handling per resource kind and result.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"kind", "result"})
+	operationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "server_operation_duration_seconds",
+		Help:      "Duration of operations (e.g. CREATE DATABASE) on database servers per server, engine and operation.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"server", "engine", "operation", "result"})
+	connectionFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "server_connection_failures_total",
+		Help:      "Number of failed connections to database servers per server and engine.",
+	}, []string{"server", "engine"})
+	errorDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "database_error_duration_seconds",
+		Help:      "Time spent by Databases in Error status before the retry.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 14),
+	})
+	orphanedObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "orphaned_objects",
+		Help: "Number of databases and users not used by any Database per server, kind and whether they're " +
+			"marked by the operator.",
+	}, []string{"server", "kind", "managed"})
+	orphansCollected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orphans_collected_total",
+		Help:      "Number of dropped orphaned databases and users per server, kind and result.",
+	}, []string{"server", "kind", "result"})
+
+	databaseStatuses = &statusCollector{
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "databases"),
+			"Number of Databases per status.", []string{"status"}, nil),
+		statuses: map[string]string{},
+	}
+)
+
+func init() {
+	prometheus.MustRegister(Leader, LeaderChanges, reconcileTotal, reconcileDuration, operationDuration,
+		connectionFailures, errorDuration, orphanedObjects, orphansCollected, databaseStatuses)
+}
+
+// ObserveReconcile records the result and duration of the handled event
+func ObserveReconcile(kind string, err error, duration time.Duration) {
+	result := resultLabel(err)
+	reconcileTotal.WithLabelValues(kind, result).Inc()
+	reconcileDuration.WithLabelValues(kind, result).Observe(duration.Seconds())
+}
+
+// ObserveOperation records the result and duration of the operation on the database server
+func ObserveOperation(server string, engine string, operation string, err error, duration time.Duration) {
+	operationDuration.WithLabelValues(server, engine, operation, resultLabel(err)).Observe(duration.Seconds())
+}
+
+// IncConnectionFailures counts failed connection to the database server
+func IncConnectionFailures(server string, engine string) {
+	connectionFailures.WithLabelValues(server, engine).Inc()
+}
+
+// ObserveErrorDuration records time spent by the Database in Error status
+func ObserveErrorDuration(duration time.Duration) {
+	errorDuration.Observe(duration.Seconds())
+}
+
+// SetDatabaseStatus records current status of the Database with the given UID
+func SetDatabaseStatus(uid string, status string) {
+	databaseStatuses.mutex.Lock()
+	defer databaseStatuses.mutex.Unlock()
+	databaseStatuses.statuses[uid] = status
+}
+
+// DeleteDatabase removes the deleted Database with the given UID
+func DeleteDatabase(uid string) {
+	databaseStatuses.mutex.Lock()
+	defer databaseStatuses.mutex.Unlock()
+	delete(databaseStatuses.statuses, uid)
+}
+
+// SetOrphanedObjects records number of orphaned objects of the given kind found on the database server
+func SetOrphanedObjects(server string, kind string, managed bool, count int) {
+	orphanedObjects.WithLabelValues(server, kind, strconv.FormatBool(managed)).Set(float64(count))
+}
+
+// DeleteOrphanedObjects removes numbers of orphaned objects of the deleted database server
+func DeleteOrphanedObjects(server string, kinds ...string) {
+	for _, kind := range kinds {
+		for _, managed := range []bool{true, false} {
+			orphanedObjects.DeleteLabelValues(server, kind, strconv.FormatBool(managed))
+		}
+	}
+}
+
+// IncOrphansCollected counts dropped orphaned object
+func IncOrphansCollected(server string, kind string, err error) {
+	orphansCollected.WithLabelValues(server, kind, resultLabel(err)).Inc()
+}
+
+func resultLabel(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultSuccess
+}
+
+// statusCollector reports number of Databases per status (based on the last handled state of each resource).
+type statusCollector struct {
+	desc *prometheus.Desc
+
+	mutex    sync.Mutex
+	statuses map[string]string
+}
+
+func (c *statusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *statusCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	counts := map[string]int{}
+	for _, status := range c.statuses {
+		counts[status]++
+	}
+	c.mutex.Unlock()
+
+	for status, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count), status)
+	}
+}
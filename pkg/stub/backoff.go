@@ -0,0 +1,41 @@
+package stub
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/jakub-bacic/database-k8s-operator/pkg/apis/jakub-bacic/v1alpha1"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/database"
+)
+
+const (
+	// initialRetryBackoff defines delay before the first retry (it's doubled after each consecutive failure)
+	initialRetryBackoff = 10 * time.Second
+	// DefaultMaxRetryBackoff defines default upper limit of the delay between retries
+	DefaultMaxRetryBackoff = 10 * time.Minute
+	// retryJitter defines maximum fraction of the delay randomly subtracted from it (so resources failing at the
+	// same time are not retried together)
+	retryJitter = 0.2
+)
+
+// scheduleRetry sets time of the next retry after the failure. Validation errors are permanent - the resource is
+// not retried until its spec changes (unless it's being deleted, the deletion is always retried).
+func scheduleRetry(db *v1alpha1.Database, err error, maxBackoff time.Duration) {
+	if _, ok := err.(*database.ValidationError); ok && db.DeletionTimestamp == nil {
+		db.SetPermanentFailure()
+		return
+	}
+	db.ScheduleRetry(retryBackoff(db.Status.RetryCount, maxBackoff))
+}
+
+// retryBackoff returns exponential delay (with jitter) before the next retry after the given number of failures
+func retryBackoff(retryCount int32, maxBackoff time.Duration) time.Duration {
+	backoff := initialRetryBackoff
+	for i := int32(0); i < retryCount && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff - time.Duration(rand.Float64()*retryJitter*float64(backoff))
+}
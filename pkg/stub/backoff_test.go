@@ -0,0 +1,68 @@
+package stub
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jakub-bacic/database-k8s-operator/pkg/apis/jakub-bacic/v1alpha1"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/database"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		retryCount int32
+		maxBackoff time.Duration
+		want       time.Duration
+	}{
+		{0, DefaultMaxRetryBackoff, 10 * time.Second},
+		{1, DefaultMaxRetryBackoff, 20 * time.Second},
+		{3, DefaultMaxRetryBackoff, 80 * time.Second},
+		{6, DefaultMaxRetryBackoff, 10 * time.Minute},
+		{1000, DefaultMaxRetryBackoff, 10 * time.Minute},
+		{0, 5 * time.Second, 5 * time.Second},
+		{2, time.Hour, 40 * time.Second},
+	}
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			got := retryBackoff(test.retryCount, test.maxBackoff)
+			min := test.want - time.Duration(retryJitter*float64(test.want))
+			if got > test.want || got < min {
+				t.Errorf("retryBackoff(%v, %v) = %v, want between %v and %v", test.retryCount, test.maxBackoff, got,
+					min, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestScheduleRetry(t *testing.T) {
+	db := &v1alpha1.Database{}
+	scheduleRetry(db, errors.New("connection refused"), DefaultMaxRetryBackoff)
+	if db.Status.NextRetryTimestamp == nil || db.Status.FailedSpecHash != "" {
+		t.Errorf("scheduleRetry() with transient error: status = %+v, want retry scheduled", db.Status)
+	}
+
+	db = &v1alpha1.Database{}
+	scheduleRetry(db, &database.ValidationError{Reason: "InvalidSpec"}, DefaultMaxRetryBackoff)
+	if db.Status.NextRetryTimestamp != nil || db.Status.FailedSpecHash != db.SpecHash() {
+		t.Errorf("scheduleRetry() with validation error: status = %+v, want permanent failure", db.Status)
+	}
+	if db.ShouldRetry() {
+		t.Errorf("ShouldRetry() = true after permanent failure with unchanged spec")
+	}
+	db.Spec.Database.Name = "changed"
+	if !db.ShouldRetry() {
+		t.Errorf("ShouldRetry() = false after permanent failure with changed spec")
+	}
+
+	db = &v1alpha1.Database{}
+	now := metav1.Now()
+	db.DeletionTimestamp = &now
+	scheduleRetry(db, &database.ValidationError{Reason: "InvalidSpec"}, DefaultMaxRetryBackoff)
+	if db.Status.NextRetryTimestamp == nil || db.Status.FailedSpecHash != "" {
+		t.Errorf("scheduleRetry() with validation error during deletion: status = %+v, want retry scheduled",
+			db.Status)
+	}
+}
@@ -0,0 +1,55 @@
+package stub
+
+import (
+	"github.com/jakub-bacic/database-k8s-operator/pkg/apis/jakub-bacic/v1alpha1"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/database"
+	"k8s.io/api/core/v1"
+)
+
+const (
+	conditionReasonResolved           = "Resolved"
+	conditionReasonResolveFailed      = "ResolveFailed"
+	conditionReasonReachable          = "Reachable"
+	conditionReasonUnreachable        = "Unreachable"
+	conditionReasonProvisioned        = "Provisioned"
+	conditionReasonProvisioningFailed = "ProvisioningFailed"
+	conditionReasonDeletionProtection = "DeletionProtection"
+	conditionReasonProtectionDisabled = "ProtectionDisabled"
+)
+
+// setFailed moves the resource to Error status, schedules the retry and updates conditions according to the error
+func (h *Handler) setFailed(db *v1alpha1.Database, err error, defaultReason string) {
+	db.SetError(errorReason(err, defaultReason), err.Error())
+	scheduleRetry(db, err, h.config.MaxRetryBackoff)
+	updateConditions(db, err)
+}
+
+// updateConditions updates conditions according to the result of the last reconciliation (err is nil if it
+// succeeded). It returns true if any condition has been changed.
+func updateConditions(db *v1alpha1.Database, err error) bool {
+	if err == nil {
+		changed := db.SetCondition(v1alpha1.ConditionSecretsResolved, v1.ConditionTrue, conditionReasonResolved, "")
+		changed = db.SetCondition(v1alpha1.ConditionServerReachable, v1.ConditionTrue, conditionReasonReachable,
+			"") || changed
+		changed = db.SetCondition(v1alpha1.ConditionUserProvisioned, v1.ConditionTrue, conditionReasonProvisioned,
+			"") || changed
+		return changed
+	}
+
+	switch err.(type) {
+	case *v1alpha1.SecretError:
+		return db.SetCondition(v1alpha1.ConditionSecretsResolved, v1.ConditionFalse, conditionReasonResolveFailed,
+			err.Error())
+	case *database.ConnectionError:
+		// root credentials must have been resolved to connect
+		changed := db.SetCondition(v1alpha1.ConditionSecretsResolved, v1.ConditionTrue, conditionReasonResolved, "")
+		return db.SetCondition(v1alpha1.ConditionServerReachable, v1.ConditionFalse, conditionReasonUnreachable,
+			err.Error()) || changed
+	default:
+		if db.DeletionTimestamp != nil {
+			return false
+		}
+		return db.SetCondition(v1alpha1.ConditionUserProvisioned, v1.ConditionFalse,
+			errorReason(err, conditionReasonProvisioningFailed), err.Error())
+	}
+}
@@ -0,0 +1,238 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jakub-bacic/database-k8s-operator/pkg/apis/jakub-bacic/v1alpha1"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/database"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// snapshotFileAnnotation stores name of the dump file written by the snapshot Job
+	snapshotFileAnnotation = "jakub-bacic.github.com/snapshot-file"
+	snapshotMountPath      = "/snapshot"
+	// snapshotBackoffLimit defines how many times the dump is retried before the Job is considered failed
+	snapshotBackoffLimit = 2
+)
+
+// snapshotImages defines default images with the dump tools of the database server types
+var snapshotImages = map[string]string{
+	v1alpha1.DatabaseServerTypeMySQL:      "mysql:8.0",
+	v1alpha1.DatabaseServerTypePostgreSQL: "postgres:11",
+}
+
+// snapshotCommands defines shell commands dumping the database. Names are passed in environment variables, so
+// they're never interpreted by the shell. The dump is renamed once it's complete.
+var snapshotCommands = map[string]string{
+	v1alpha1.DatabaseServerTypeMySQL: `mysqldump --host="$DB_HOST" --port="$DB_PORT" --user="$DB_USER" ` +
+		`--single-transaction --routines --databases "$DB_NAME" > "$SNAPSHOT_PATH.tmp" && ` +
+		`mv "$SNAPSHOT_PATH.tmp" "$SNAPSHOT_PATH"`,
+	v1alpha1.DatabaseServerTypePostgreSQL: `pg_dump --host="$DB_HOST" --port="$DB_PORT" --username="$DB_USER" ` +
+		`--file="$SNAPSHOT_PATH.tmp" "$DB_NAME" && mv "$SNAPSHOT_PATH.tmp" "$SNAPSHOT_PATH"`,
+}
+
+// snapshotPasswordEnvVars defines environment variables with the password read by the dump tools
+var snapshotPasswordEnvVars = map[string]string{
+	v1alpha1.DatabaseServerTypeMySQL:      "MYSQL_PWD",
+	v1alpha1.DatabaseServerTypePostgreSQL: "PGPASSWORD",
+}
+
+// validateDeletion checks if the resource can be deleted. The database server must be the one the spec has been
+// applied on (the change has been rejected, so the database doesn't exist on the new server).
+func validateDeletion(db *v1alpha1.Database) error {
+	if applied := db.Status.AppliedSpec; applied != nil && applied.DatabaseServer != db.DatabaseServerID() {
+		return &database.ValidationError{
+			Reason: v1alpha1.ReasonInvalidSpec,
+			Message: fmt.Sprintf("database server has been changed, revert it to delete the database (current "+
+				"server: %v)", applied.DatabaseServer),
+		}
+	}
+	return validateDeletionPolicy(db)
+}
+
+// validateDeletionPolicy checks if the deletion policy is supported and the snapshot is configured when needed
+func validateDeletionPolicy(db *v1alpha1.Database) error {
+	options := db.Spec.Options
+	if options == nil {
+		return nil
+	}
+
+	switch options.DeletionPolicy {
+	case "", v1alpha1.DeletionPolicyDelete, v1alpha1.DeletionPolicyRetain, v1alpha1.DeletionPolicyRetainData:
+		return nil
+	case v1alpha1.DeletionPolicySnapshot:
+		if options.Snapshot == nil || options.Snapshot.PersistentVolumeClaim == "" {
+			return &database.ValidationError{
+				Reason:  v1alpha1.ReasonInvalidSpec,
+				Message: "snapshot.persistentVolumeClaim must be set when deletionPolicy is Snapshot",
+			}
+		}
+		return nil
+	default:
+		return &database.ValidationError{
+			Reason: v1alpha1.ReasonInvalidSpec,
+			Message: fmt.Sprintf("unsupported deletionPolicy: %v (must be one of Delete, Retain, RetainData, Snapshot)",
+				options.DeletionPolicy),
+		}
+	}
+}
+
+// takeSnapshot starts the Job dumping the database to the configured volume and returns true once it succeeds.
+// The failed Job is removed, so it's started again when the resource is retried.
+func (h *Handler) takeSnapshot(ctx context.Context, db *v1alpha1.Database) (bool, error) {
+	if err := validateDeletionPolicy(db); err != nil {
+		return false, err
+	}
+
+	job := newJob(db.Namespace, snapshotJobName(db))
+	if err := sdk.Get(job); err != nil {
+		if errors.IsNotFound(err) {
+			return false, h.startSnapshot(ctx, db)
+		}
+		return false, fmt.Errorf("failed to get job (%v/%v): %v", job.Namespace, job.Name, err)
+	}
+	if !metav1.IsControlledBy(job, db) {
+		return false, fmt.Errorf("job (%v/%v) already exists and is not owned by the resource", job.Namespace, job.Name)
+	}
+
+	if job.Status.Succeeded > 0 {
+		h.recordEvent(ctx, db, v1.EventTypeNormal, eventReasonSnapshotTaken, "Snapshot of database %v saved to %v/%v",
+			db.Spec.Database.Name, db.Spec.Options.Snapshot.PersistentVolumeClaim, job.Annotations[snapshotFileAnnotation])
+		return true, nil
+	}
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == v1.ConditionTrue {
+			propagationPolicy := metav1.DeletePropagationBackground
+			err := sdk.Delete(job, sdk.WithDeleteOptions(&metav1.DeleteOptions{PropagationPolicy: &propagationPolicy}))
+			if err != nil && !errors.IsNotFound(err) {
+				return false, fmt.Errorf("failed to delete job (%v/%v): %v", job.Namespace, job.Name, err)
+			}
+			return false, fmt.Errorf("snapshot job %v failed: %v", job.Name, condition.Message)
+		}
+	}
+	return false, nil
+}
+
+// startSnapshot creates the snapshot Job dumping the database with credentials of the user (the Job is owned by the
+// resource, so it's removed together with it)
+func (h *Handler) startSnapshot(ctx context.Context, db *v1alpha1.Database) error {
+	spec, err := getServerSpec(db)
+	if err != nil {
+		return err
+	}
+	command, ok := snapshotCommands[spec.Type]
+	if !ok {
+		return &database.ValidationError{
+			Reason:  v1alpha1.ReasonInvalidSpec,
+			Message: fmt.Sprintf("snapshots are not supported by %v database server", spec.Type),
+		}
+	}
+
+	// the dump runs as the application user (the root password is never exposed in the namespace of the resource)
+	passwordRef := userPasswordSecretRef(db)
+
+	snapshot := db.Spec.Options.Snapshot
+	image := snapshot.Image
+	if image == "" {
+		image = snapshotImages[spec.Type]
+	}
+	file := fmt.Sprintf("%v-%v-%v.sql", db.Namespace, db.Name, time.Now().UTC().Format("20060102150405"))
+	backoffLimit := int32(snapshotBackoffLimit)
+
+	job := newJob(db.Namespace, snapshotJobName(db))
+	job.Annotations = map[string]string{snapshotFileAnnotation: file}
+	job.OwnerReferences = []metav1.OwnerReference{
+		*metav1.NewControllerRef(db, v1alpha1.SchemeGroupVersion.WithKind("Database")),
+	}
+	job.Spec = batchv1.JobSpec{
+		BackoffLimit: &backoffLimit,
+		Template: v1.PodTemplateSpec{
+			Spec: v1.PodSpec{
+				RestartPolicy: v1.RestartPolicyNever,
+				Containers: []v1.Container{{
+					Name:    "snapshot",
+					Image:   image,
+					Command: []string{"sh", "-c", command},
+					Env: []v1.EnvVar{
+						{Name: "DB_HOST", Value: spec.Host},
+						{Name: "DB_PORT", Value: strconv.Itoa(int(spec.Port))},
+						{Name: "DB_USER", Value: db.ActiveUser()},
+						{Name: "DB_NAME", Value: appliedDatabaseName(db)},
+						{Name: "SNAPSHOT_PATH", Value: snapshotMountPath + "/" + file},
+						{
+							Name: snapshotPasswordEnvVars[spec.Type],
+							ValueFrom: &v1.EnvVarSource{
+								SecretKeyRef: passwordRef,
+							},
+						},
+					},
+					VolumeMounts: []v1.VolumeMount{{Name: "snapshot", MountPath: snapshotMountPath}},
+				}},
+				Volumes: []v1.Volume{{
+					Name: "snapshot",
+					VolumeSource: v1.VolumeSource{
+						PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+							ClaimName: snapshot.PersistentVolumeClaim,
+						},
+					},
+				}},
+			},
+		},
+	}
+	if spec.Type == v1alpha1.DatabaseServerTypePostgreSQL && spec.SSLMode != "" {
+		container := &job.Spec.Template.Spec.Containers[0]
+		container.Env = append(container.Env, v1.EnvVar{Name: "PGSSLMODE", Value: spec.SSLMode})
+	}
+	if err := sdk.Create(job); err != nil {
+		return fmt.Errorf("failed to create job (%v/%v): %v", job.Namespace, job.Name, err)
+	}
+
+	h.recordEvent(ctx, db, v1.EventTypeNormal, eventReasonSnapshotStarted, "Taking snapshot of database %v to %v/%v",
+		db.Spec.Database.Name, snapshot.PersistentVolumeClaim, file)
+	return nil
+}
+
+// snapshotJobName returns name of the snapshot Job (it's used as a label value, so it can't exceed 63 characters)
+func snapshotJobName(db *v1alpha1.Database) string {
+	const suffix = "-snapshot"
+	name := db.Name
+	if len(name) > 63-len(suffix) {
+		name = name[:63-len(suffix)]
+	}
+	return name + suffix
+}
+
+func newJob(namespace string, name string) *batchv1.Job {
+	return &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+}
+
+// userPasswordSecretRef returns reference to the Secret key with the password of the user (either passwordSecretRef
+// or the output Secret with the generated password)
+func userPasswordSecretRef(db *v1alpha1.Database) *v1.SecretKeySelector {
+	if !db.GeneratedPassword() {
+		ref := db.Spec.Database.PasswordSecretRef
+		return &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: ref.Name}, Key: ref.Key}
+	}
+	name := db.Status.OutputSecretName
+	if name == "" {
+		name = db.Spec.OutputSecret.Name
+	}
+	return &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: name}, Key: outputSecretPasswordKey}
+}
@@ -0,0 +1,58 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jakub-bacic/database-k8s-operator/pkg/apis/jakub-bacic/v1alpha1"
+	"k8s.io/api/core/v1"
+)
+
+const (
+	driftReasonObjectsRecreated = "ObjectsRecreated"
+	driftReasonInSync           = "InSync"
+)
+
+// reconcileDrift checks if the database, the user and its privileges still exist on the database server and
+// recreates the missing ones. It returns true if the Drifted condition has been changed.
+func (h *Handler) reconcileDrift(ctx context.Context, db *v1alpha1.Database) (bool, error) {
+	dbServer, err := h.getDatabaseServer(ctx, db)
+	if err != nil {
+		return false, err
+	}
+
+	state, err := dbServer.GetDatabaseState(db.Spec.Database.Name, db.Spec.Database.User, db.ActiveUser())
+	if err != nil {
+		return false, err
+	}
+
+	missing := state.Missing()
+	if len(missing) == 0 {
+		return db.SetCondition(v1alpha1.ConditionDrifted, v1.ConditionFalse, driftReasonInSync, ""), nil
+	}
+
+	userCredentials, err := getUserCredentials(db)
+	if err != nil {
+		return false, err
+	}
+
+	if !state.DatabaseExists || !state.OwnerAssigned {
+		// CreateDatabase restores the owner of an existing database
+		if err := dbServer.CreateDatabase(db.Spec.Database.Name, db.Spec.Database.User); err != nil {
+			return false, err
+		}
+		if err := h.markOwnership(db, dbServer, databaseObjects(db)...); err != nil {
+			return false, err
+		}
+	}
+	if err := dbServer.CreateUser(db.Spec.Database.Name, db.Spec.Database.User, userCredentials); err != nil {
+		return false, err
+	}
+	if err := h.markOwnership(db, dbServer, userObject(userCredentials.User)); err != nil {
+		return false, err
+	}
+
+	message := fmt.Sprintf("recreated missing objects: %v", strings.Join(missing, ", "))
+	return db.SetCondition(v1alpha1.ConditionDrifted, v1.ConditionTrue, driftReasonObjectsRecreated, message), nil
+}
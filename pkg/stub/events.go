@@ -0,0 +1,49 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jakub-bacic/database-k8s-operator/pkg/apis/jakub-bacic/v1alpha1"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/logging"
+	"k8s.io/api/core/v1"
+)
+
+// eventComponent identifies the operator as the source of the recorded events
+const eventComponent = "database-k8s-operator"
+
+const (
+	eventReasonCreating           = "Creating"
+	eventReasonCreated            = "Created"
+	eventReasonAdopted            = "Adopted"
+	eventReasonUpdated            = "Updated"
+	eventReasonDrifted            = "Drifted"
+	eventReasonPasswordUpdated    = "PasswordUpdated"
+	eventReasonCredentialsRotated = "CredentialsRotated"
+	eventReasonDeleting           = "Deleting"
+	eventReasonDeleted            = "Deleted"
+	eventReasonDeleteSkipped      = "DeleteSkipped"
+	eventReasonDeletionBlocked    = "DeletionBlocked"
+	eventReasonDeletionUnblocked  = "DeletionUnblocked"
+	eventReasonUsersDeleted       = "UsersDeleted"
+	eventReasonSnapshotStarted    = "SnapshotStarted"
+	eventReasonSnapshotTaken      = "SnapshotTaken"
+	eventReasonRetrying           = "Retrying"
+)
+
+// recordEvent records the event attached to the Database resource (failures are only logged, so they don't affect
+// the reconciliation)
+func (h *Handler) recordEvent(ctx context.Context, db *v1alpha1.Database, eventType string, reason string,
+	messageFormat string, args ...interface{}) {
+	object := &v1.ObjectReference{
+		Kind:            "Database",
+		APIVersion:      v1alpha1.SchemeGroupVersion.String(),
+		Namespace:       db.Namespace,
+		Name:            db.Name,
+		UID:             db.UID,
+		ResourceVersion: db.ResourceVersion,
+	}
+	if err := h.recorder.Event(object, eventType, reason, fmt.Sprintf(messageFormat, args...)); err != nil {
+		logging.GetLogger(ctx).Warnf("failed to record event: %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package stub
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// hasFinalizer checks if the resource has the finalizer with the given name
+func hasFinalizer(object metav1.Object, name string) bool {
+	for _, finalizer := range object.GetFinalizers() {
+		if finalizer == name {
+			return true
+		}
+	}
+	return false
+}
+
+// addFinalizer adds the finalizer to the resource (finalizers added by other controllers are kept)
+func addFinalizer(object metav1.Object, name string) {
+	if !hasFinalizer(object, name) {
+		object.SetFinalizers(append(object.GetFinalizers(), name))
+	}
+}
+
+// removeFinalizer removes the finalizer from the resource (finalizers added by other controllers are kept)
+func removeFinalizer(object metav1.Object, name string) {
+	var finalizers []string
+	for _, finalizer := range object.GetFinalizers() {
+		if finalizer != name {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	object.SetFinalizers(finalizers)
+}
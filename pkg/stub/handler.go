@@ -2,8 +2,13 @@ package stub
 
 import (
 	"context"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/jakub-bacic/database-k8s-operator/pkg/events"
 	"github.com/jakub-bacic/database-k8s-operator/pkg/logging"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/metrics"
 
 	"github.com/jakub-bacic/database-k8s-operator/pkg/apis/jakub-bacic/v1alpha1"
 
@@ -11,132 +16,576 @@ import (
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jakub-bacic/database-k8s-operator/pkg/database"
+	_ "github.com/lib/pq"
 	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func NewHandler() sdk.Handler {
-	return &Handler{}
+// serverCheckInterval defines how often (in seconds) DatabaseServer resources are checked for reachability
+const serverCheckInterval = 60
+
+// Config defines settings of the handler.
+type Config struct {
+	// Upper limit of the delay between retries of the failed resources
+	MaxRetryBackoff time.Duration
+	// Default deletion policy (used if neither deletionPolicy nor dropOnDelete is set in Database spec)
+	DeletionPolicy string
+	// Enabled database server types (all types are enabled if empty)
+	Engines []string
+	// Maximum number of concurrent operations (and open connections) per database server (0 means no limit)
+	MaxServerConnections int
+	// Watched namespaces (used to find orphaned objects on the database servers, all namespaces if empty)
+	Namespaces []string
+	// ID of the operator instance stored in ownership markers (only objects marked by the same instance are
+	// collected as orphans)
+	InstanceID string
+}
+
+func NewHandler(config Config) sdk.Handler {
+	if config.MaxRetryBackoff <= 0 {
+		config.MaxRetryBackoff = DefaultMaxRetryBackoff
+	}
+	if config.DeletionPolicy == "" {
+		config.DeletionPolicy = v1alpha1.DeletionPolicyDelete
+	}
+	if len(config.Namespaces) == 0 {
+		config.Namespaces = []string{metav1.NamespaceAll}
+	}
+	return &Handler{
+		config:   config,
+		recorder: events.NewRecorder(eventComponent),
+		limiter:  database.NewLimiter(config.MaxServerConnections),
+	}
 }
 
 type Handler struct {
+	config   Config
+	recorder *events.Recorder
+	// limits concurrent operations on the database servers (events are handled by multiple workers)
+	limiter *database.Limiter
+	// mutexes of the resources being handled (keyed by UID)
+	locks sync.Map
+}
+
+// lock locks the resource with the given key and returns the function unlocking it
+func (h *Handler) lock(key string) func() {
+	mutex, _ := h.locks.LoadOrStore(key, &sync.Mutex{})
+	mutex.(*sync.Mutex).Lock()
+	return mutex.(*sync.Mutex).Unlock
 }
 
 func (h *Handler) Handle(ctx context.Context, event sdk.Event) error {
 	// ignore events with Deleted flag (all logic is handled using Finalizers)
 	if event.Deleted {
+		if db, ok := event.Object.(*v1alpha1.Database); ok {
+			h.locks.Delete(string(db.UID))
+			metrics.DeleteDatabase(string(db.UID))
+		}
+		if server, ok := event.Object.(*v1alpha1.DatabaseServer); ok {
+			metrics.DeleteOrphanedObjects(server.Name, string(database.ObjectDatabase), string(database.ObjectUser))
+		}
 		return nil
 	}
 
+	start := time.Now()
+	var err error
 	switch o := event.Object.(type) {
 	case *v1alpha1.Database:
-		ctx = logging.NewContext(ctx, logging.Fields{
-			"kind": "v1alpha1.Database",
-			"name": o.Name,
-		})
-		logger := logging.GetLogger(ctx)
+		err = h.handleDatabase(ctx, o)
+		metrics.ObserveReconcile("Database", err, time.Since(start))
+	case *v1alpha1.DatabaseServer:
+		err = h.handleDatabaseServer(ctx, o)
+		metrics.ObserveReconcile("DatabaseServer", err, time.Since(start))
+	case *v1.Secret:
+		err = h.handleSecret(ctx, o)
+		metrics.ObserveReconcile("Secret", err, time.Since(start))
+	}
+	return err
+}
 
-		switch status := o.Status.Status; status {
-		case v1alpha1.StatusInitial:
-			logger.Infof("Initializing resource")
-			db := o.DeepCopy()
-			db.InitWithDefaults()
-			return sdk.Update(db)
-		case v1alpha1.StatusCreating:
-			logger = logger.WithFields(logging.Fields{
-				"dbName":   o.Spec.Database.Name,
-				"dbUser":   o.Spec.Database.User,
-				"dbServer": o.Spec.DatabaseServer.Host,
-			})
-			logger.Infof("Creating db")
+func (h *Handler) handleDatabase(ctx context.Context, o *v1alpha1.Database) error {
+	// the resource may be also handled on changes of its Secrets
+	unlock := h.lock(string(o.UID))
+	defer unlock()
+	if o.Status.Status == v1alpha1.StatusInitial {
+		metrics.SetDatabaseStatus(string(o.UID), "Initial")
+	} else {
+		metrics.SetDatabaseStatus(string(o.UID), o.Status.Status)
+	}
+
+	ctx = logging.NewContext(ctx, logging.Fields{
+		"kind": "v1alpha1.Database",
+		"name": o.Name,
+	})
+	logger := logging.GetLogger(ctx)
+
+	// finalizers can't be added to the resource being deleted, so the legacy one is just removed in Deleting status
+	if o.DeletionTimestamp == nil && hasFinalizer(o, v1alpha1.LegacyFinalizerDeleteDb) {
+		logger.Infof("Migrating finalizer %v to %v", v1alpha1.LegacyFinalizerDeleteDb, v1alpha1.FinalizerDeleteDb)
+		db := o.DeepCopy()
+		removeFinalizer(db, v1alpha1.LegacyFinalizerDeleteDb)
+		addFinalizer(db, v1alpha1.FinalizerDeleteDb)
+		return updateDatabase(o, db)
+	}
+
+	switch status := o.Status.Status; status {
+	case v1alpha1.StatusInitial:
+		logger.Infof("Initializing resource")
+		db := o.DeepCopy()
+		db.InitWithDefaults(h.config.DeletionPolicy)
+		// finalizer is added before anything is created, so the database is never left behind
+		addFinalizer(db, v1alpha1.FinalizerDeleteDb)
+		return updateDatabase(o, db)
+	case v1alpha1.StatusCreating:
+		logger = logger.WithFields(logging.Fields{
+			"dbName":   o.Spec.Database.Name,
+			"dbUser":   o.Spec.Database.User,
+			"dbServer": o.DatabaseServerName(),
+		})
+		logger.Infof("Creating db")
+		h.recordEvent(ctx, o, v1.EventTypeNormal, eventReasonCreating, "Creating database %v on %v",
+			o.Spec.Database.Name, o.DatabaseServerName())
+		db := o.DeepCopy()
+		if err := h.createDatabase(ctx, db); err != nil {
+			logger.Warnf("failed to create db: %v", err)
+			h.setFailed(db, err, v1alpha1.ReasonCreateFailed)
+			h.recordEvent(ctx, db, v1.EventTypeWarning, db.Status.Reason, "Failed to create database: %v", err)
+			return updateDatabase(o, db)
+		}
+		logger.Infof("Database created")
+		h.recordEvent(ctx, db, v1.EventTypeNormal, eventReasonCreated, "Database %v created on %v",
+			db.Spec.Database.Name, db.DatabaseServerName())
+		// resources initialized by the previous versions don't have the finalizer yet
+		addFinalizer(db, v1alpha1.FinalizerDeleteDb)
+		db.SetStatus(v1alpha1.StatusCreated)
+		updateConditions(db, nil)
+		return updateDatabase(o, db)
+	case v1alpha1.StatusCreated:
+		if o.DeletionTimestamp != nil {
+			logger.Infof("Resource has been scheduled for deletion")
+			h.recordEvent(ctx, o, v1.EventTypeNormal, eventReasonDeleting, "Resource has been scheduled for deletion")
 			db := o.DeepCopy()
-			if err := createDatabase(ctx, db); err != nil {
-				logger.Warnf("failed to create db: %v", err)
-				db.SetStatus(v1alpha1.StatusError)
-				return sdk.Update(db)
+			db.SetStatus(v1alpha1.StatusDeleting)
+			return updateDatabase(o, db)
+		}
+
+		db := o.DeepCopy()
+		if o.Generation != o.Status.ObservedGeneration {
+			changed, err := h.applySpecChanges(ctx, db)
+			if err != nil {
+				logger.Warnf("failed to apply spec changes: %v", err)
+				h.setFailed(db, err, v1alpha1.ReasonUpdateFailed)
+				h.recordEvent(ctx, db, v1.EventTypeWarning, db.Status.Reason, "Failed to apply spec changes: %v", err)
+				return updateDatabase(o, db)
 			}
-			logger.Infof("Database created")
-			db.SetFinalizers([]string{v1alpha1.FinalizerDeleteDb})
-			db.SetStatus(v1alpha1.StatusCreated)
-			return sdk.Update(db)
-		case v1alpha1.StatusCreated:
-			if o.DeletionTimestamp != nil {
-				logger.Infof("Resource has been scheduled for deletion")
-				db := o.DeepCopy()
-				db.SetStatus(v1alpha1.StatusDeleting)
-				return sdk.Update(db)
+			if changed {
+				updateConditions(db, nil)
+				logger.Infof("Spec changes applied (generation: %v)", db.Status.ObservedGeneration)
+				h.recordEvent(ctx, db, v1.EventTypeNormal, eventReasonUpdated, "Spec changes applied (generation: %v)",
+					db.Status.ObservedGeneration)
+				return updateDatabase(o, db)
 			}
-		case v1alpha1.StatusDeleting:
-			logger = logger.WithFields(logging.Fields{
-				"dbName":   o.Spec.Database.Name,
-				"dbUser":   o.Spec.Database.User,
-				"dbServer": o.Spec.DatabaseServer.Host,
-			})
-			db := o.DeepCopy()
-			if db.DropOnDelete() {
-				logger.Infof("Deleting db")
-				if err := deleteDatabase(ctx, db); err != nil {
-					logger.Warnf("failed to delete db: %v", err)
-					db.SetStatus(v1alpha1.StatusError)
-					return sdk.Update(db)
-				}
-				logger.Infof("Database deleted")
-			} else {
-				logger.Infof("DropOnDelete is disabled - skipping delete action")
+		}
+
+		drifted, err := h.reconcileDrift(ctx, db)
+		if err != nil {
+			logger.Warnf("failed to reconcile drift: %v", err)
+			h.setFailed(db, err, v1alpha1.ReasonDriftReconcileFailed)
+			h.recordEvent(ctx, db, v1.EventTypeWarning, db.Status.Reason, "Failed to reconcile drift: %v", err)
+			return updateDatabase(o, db)
+		}
+		if drifted {
+			updateConditions(db, nil)
+			if condition := db.GetCondition(v1alpha1.ConditionDrifted); condition.Status == v1.ConditionTrue {
+				logger.Warnf("Database drifted: %v", condition.Message)
+				h.recordEvent(ctx, db, v1.EventTypeWarning, eventReasonDrifted, "Database drifted: %v",
+					condition.Message)
+			}
+			return updateDatabase(o, db)
+		}
+
+		updated, err := h.updateUserPassword(ctx, db)
+		if err != nil {
+			logger.Warnf("failed to update user password: %v", err)
+			h.setFailed(db, err, v1alpha1.ReasonPasswordUpdateFailed)
+			h.recordEvent(ctx, db, v1.EventTypeWarning, db.Status.Reason, "Failed to update user password: %v", err)
+			return updateDatabase(o, db)
+		}
+		if updated {
+			updateConditions(db, nil)
+			logger.Infof("User password updated")
+			h.recordEvent(ctx, db, v1.EventTypeNormal, eventReasonPasswordUpdated, "Password of user %v updated",
+				db.ActiveUser())
+			return updateDatabase(o, db)
+		}
+
+		rotated, err := h.rotateCredentials(ctx, db)
+		if err != nil {
+			logger.Warnf("failed to rotate credentials: %v", err)
+			h.setFailed(db, err, v1alpha1.ReasonRotationFailed)
+			h.recordEvent(ctx, db, v1.EventTypeWarning, db.Status.Reason, "Failed to rotate credentials: %v", err)
+			return updateDatabase(o, db)
+		}
+		if rotated {
+			updateConditions(db, nil)
+			logger.Infof("Credentials rotated (active user: %v)", db.ActiveUser())
+			h.recordEvent(ctx, db, v1.EventTypeNormal, eventReasonCredentialsRotated,
+				"Credentials rotated (active user: %v)", db.ActiveUser())
+			return updateDatabase(o, db)
+		}
+
+		if err := h.reconcileOutputSecret(ctx, db); err != nil {
+			logger.Warnf("failed to update output secret: %v", err)
+			h.setFailed(db, err, v1alpha1.ReasonOutputSecretFailed)
+			h.recordEvent(ctx, db, v1.EventTypeWarning, db.Status.Reason, "Failed to update output secret: %v", err)
+			return updateDatabase(o, db)
+		}
+
+		updateConditions(db, nil)
+		return updateDatabase(o, db)
+	case v1alpha1.StatusDeleting:
+		logger = logger.WithFields(logging.Fields{
+			"dbName":   o.Spec.Database.Name,
+			"dbUser":   o.Spec.Database.User,
+			"dbServer": o.DatabaseServerName(),
+		})
+		db := o.DeepCopy()
+		if db.DeletionProtected() {
+			// the finalizer is kept, so the resource (and the database) stays until the protection is disabled
+			if db.SetCondition(v1alpha1.ConditionDeletionBlocked, v1.ConditionTrue, conditionReasonDeletionProtection,
+				"deletion protection is enabled") {
+				logger.Warnf("Deletion blocked by deletion protection")
+				h.recordEvent(ctx, db, v1.EventTypeWarning, eventReasonDeletionBlocked,
+					"Deletion of database %v is blocked by deletion protection", db.Spec.Database.Name)
+			}
+			return updateDatabase(o, db)
+		}
+		if condition := db.GetCondition(v1alpha1.ConditionDeletionBlocked); condition != nil &&
+			condition.Status == v1.ConditionTrue {
+			// the resource is handled again after the status update
+			db.SetCondition(v1alpha1.ConditionDeletionBlocked, v1.ConditionFalse, conditionReasonProtectionDisabled, "")
+			logger.Infof("Deletion protection disabled")
+			h.recordEvent(ctx, db, v1.EventTypeNormal, eventReasonDeletionUnblocked,
+				"Deletion protection disabled - deleting resource")
+			return updateDatabase(o, db)
+		}
+		// unsupported policy must not fall back to dropping the database
+		if err := validateDeletion(db); err != nil {
+			logger.Warnf("invalid deletion policy: %v", err)
+			h.setFailed(db, err, v1alpha1.ReasonDeleteFailed)
+			h.recordEvent(ctx, db, v1.EventTypeWarning, db.Status.Reason, "Failed to delete database: %v", err)
+			return updateDatabase(o, db)
+		}
+		switch policy := db.DeletionPolicy(h.config.DeletionPolicy); policy {
+		case v1alpha1.DeletionPolicyRetain:
+			if err := h.releaseOwnership(ctx, db, retainedObjects(db, true)...); err != nil {
+				logger.Warnf("failed to release ownership: %v", err)
+				h.setFailed(db, err, v1alpha1.ReasonDeleteFailed)
+				h.recordEvent(ctx, db, v1.EventTypeWarning, db.Status.Reason, "Failed to release ownership: %v", err)
+				return updateDatabase(o, db)
 			}
-			db.SetFinalizers([]string{})
-			return sdk.Update(db)
-		case v1alpha1.StatusError:
-			// should be adjusted according to resyncPeriod
-			if o.TimeSinceLastError() >= 10 {
-				logger.Infof("Trying to recover from error status")
-				db := o.DeepCopy()
-				if o.DeletionTimestamp == nil {
-					db.SetStatus(v1alpha1.StatusCreating)
-				} else {
-					db.SetStatus(v1alpha1.StatusDeleting)
+			logger.Infof("Deletion policy is %v - skipping delete action", policy)
+			h.recordEvent(ctx, db, v1.EventTypeNormal, eventReasonDeleteSkipped,
+				"Deletion policy is %v - database %v is kept on %v", policy, db.Spec.Database.Name,
+				db.DatabaseServerName())
+		case v1alpha1.DeletionPolicyRetainData:
+			logger.Infof("Deleting users")
+			if err := h.deleteUsers(ctx, db); err != nil {
+				logger.Warnf("failed to delete users: %v", err)
+				h.setFailed(db, err, v1alpha1.ReasonDeleteFailed)
+				h.recordEvent(ctx, db, v1.EventTypeWarning, db.Status.Reason, "Failed to delete users: %v", err)
+				return updateDatabase(o, db)
+			}
+			if err := h.releaseOwnership(ctx, db, retainedObjects(db, false)...); err != nil {
+				logger.Warnf("failed to release ownership: %v", err)
+				h.setFailed(db, err, v1alpha1.ReasonDeleteFailed)
+				h.recordEvent(ctx, db, v1.EventTypeWarning, db.Status.Reason, "Failed to release ownership: %v", err)
+				return updateDatabase(o, db)
+			}
+			logger.Infof("Users deleted")
+			h.recordEvent(ctx, db, v1.EventTypeNormal, eventReasonUsersDeleted,
+				"Deletion policy is %v - users deleted, database %v is kept on %v", policy, db.Spec.Database.Name,
+				db.DatabaseServerName())
+		default:
+			if policy == v1alpha1.DeletionPolicySnapshot {
+				taken, err := h.takeSnapshot(ctx, db)
+				if err != nil {
+					logger.Warnf("failed to take snapshot: %v", err)
+					h.setFailed(db, err, v1alpha1.ReasonSnapshotFailed)
+					h.recordEvent(ctx, db, v1.EventTypeWarning, db.Status.Reason, "Failed to take snapshot: %v", err)
+					return updateDatabase(o, db)
+				}
+				if !taken {
+					// snapshot Job is checked again on resync
+					return nil
 				}
-				return sdk.Update(db)
 			}
+
+			logger.Infof("Deleting db")
+			if err := h.deleteDatabase(ctx, db); err != nil {
+				logger.Warnf("failed to delete db: %v", err)
+				h.setFailed(db, err, v1alpha1.ReasonDeleteFailed)
+				h.recordEvent(ctx, db, v1.EventTypeWarning, db.Status.Reason, "Failed to delete database: %v", err)
+				return updateDatabase(o, db)
+			}
+			logger.Infof("Database deleted")
+			h.recordEvent(ctx, db, v1.EventTypeNormal, eventReasonDeleted, "Database %v deleted from %v",
+				db.Spec.Database.Name, db.DatabaseServerName())
+		}
+		removeFinalizer(db, v1alpha1.FinalizerDeleteDb)
+		removeFinalizer(db, v1alpha1.LegacyFinalizerDeleteDb)
+		return updateDatabase(o, db)
+	case v1alpha1.StatusError:
+		if o.DeletionTimestamp != nil && !createdAnything(o) {
+			// the finalizer is added before the creation, so the resource which failed right away is released
+			// without touching the database server (its spec might not even be valid)
+			logger.Infof("Nothing has been created - removing finalizer")
+			db := o.DeepCopy()
+			removeFinalizer(db, v1alpha1.FinalizerDeleteDb)
+			removeFinalizer(db, v1alpha1.LegacyFinalizerDeleteDb)
+			return updateDatabase(o, db)
+		}
+		// retries are checked on resync, so the actual delay is rounded up to the resync period
+		if o.ShouldRetry() {
+			logger.Infof("Trying to recover from error status (retry: %v)", o.Status.RetryCount)
+			h.recordEvent(ctx, o, v1.EventTypeNormal, eventReasonRetrying, "Retrying after error (%v, retry: %v)",
+				o.Status.Reason, o.Status.RetryCount)
+			if o.Status.LastErrorTimestamp != nil {
+				metrics.ObserveErrorDuration(time.Since(time.Unix(*o.Status.LastErrorTimestamp, 0)))
+			}
+			db := o.DeepCopy()
+			if o.DeletionTimestamp == nil {
+				db.SetStatus(v1alpha1.StatusCreating)
+			} else {
+				db.SetStatus(v1alpha1.StatusDeleting)
+			}
+			return updateDatabase(o, db)
 		}
 	}
 	return nil
 }
 
-func createDatabase(ctx context.Context, db *v1alpha1.Database) error {
-	dbServer, err := getDatabaseServer(ctx, db)
+func (h *Handler) handleDatabaseServer(ctx context.Context, o *v1alpha1.DatabaseServer) error {
+	ctx = logging.NewContext(ctx, logging.Fields{
+		"kind": "v1alpha1.DatabaseServer",
+		"name": o.Name,
+	})
+	logger := logging.GetLogger(ctx)
+
+	if o.TimeSinceLastCheck() < serverCheckInterval {
+		return nil
+	}
+
+	server := o.DeepCopy()
+	dbServer, version, err := h.checkDatabaseServer(server)
+	if err != nil {
+		if o.Status.Reachable || o.Status.LastCheckTimestamp == nil {
+			logger.Warnf("Database server is not reachable: %v", err)
+		}
+		server.SetUnreachable(err.Error())
+	} else {
+		if !o.Status.Reachable {
+			logger.Infof("Database server is reachable (version: %v)", version)
+		}
+		server.SetReachable(version)
+		// orphans found during the previous check are kept in the status
+		if err := h.updateOrphans(ctx, server, dbServer); err != nil {
+			logger.Warnf("failed to find orphaned objects: %v", err)
+		}
+	}
+	return updateDatabaseServer(o, server)
+}
+
+func (h *Handler) createDatabase(ctx context.Context, db *v1alpha1.Database) error {
+	if err := validateSpecChanges(db); err != nil {
+		return err
+	}
+	if err := validateRotation(db); err != nil {
+		return err
+	}
+	if err := validateDeletionPolicy(db); err != nil {
+		return err
+	}
+
+	dbServer, err := h.getDatabaseServer(ctx, db)
 	if err != nil {
 		return err
 	}
 
-	userCredentials, err := db.GetDatabaseUserCredentials()
+	// users of the applied spec are dropped once the new ones are ready
+	previousUsers := replacedUsers(db)
+	if applied := db.Status.AppliedSpec; db.Spec.Rotation == nil ||
+		applied != nil && applied.User != db.Spec.Database.User {
+		db.Status.Rotation = nil
+	}
+
+	if db.Spec.Rotation != nil && db.Status.Rotation == nil {
+		// the first rotation user is activated right away
+		userA, _ := db.RotationUsers()
+		db.Status.Rotation = &v1alpha1.RotationStatus{ActiveUser: userA, LastRotationTimestamp: time.Now().Unix()}
+	}
+
+	userCredentials, err := getUserCredentials(db)
 	if err != nil {
 		return err
 	}
 
-	if err := dbServer.CreateDatabase(db.Spec.Database.Name, userCredentials); err != nil {
+	// CREATE ... IF NOT EXISTS statements would take over existing objects silently
+	objects := append(databaseObjects(db), userObject(userCredentials.User))
+	if err := h.checkOwnership(ctx, db, dbServer, objects...); err != nil {
 		return err
 	}
 
+	// objects are marked right after they're created, so they're not considered foreign when the creation is retried
+	if err := dbServer.CreateDatabase(db.Spec.Database.Name, db.Spec.Database.User); err != nil {
+		return err
+	}
+	if err := h.markOwnership(db, dbServer, databaseObjects(db)...); err != nil {
+		return err
+	}
+
+	if err := dbServer.CreateUser(db.Spec.Database.Name, db.Spec.Database.User, userCredentials); err != nil {
+		return err
+	}
+	if err := h.markOwnership(db, dbServer, userObject(userCredentials.User)); err != nil {
+		return err
+	}
+
+	connectionDetails := dbServer.GetConnectionDetails(db.Spec.Database.Name, userCredentials)
+	if err := updateOutputSecret(db, connectionDetails); err != nil {
+		return err
+	}
+
+	db.SetPasswordHash(db.PasswordHash(userCredentials.Password))
+
+	for _, user := range previousUsers {
+		if err := dbServer.DeleteUser(db.Spec.Database.Name, user); err != nil {
+			return err
+		}
+	}
+
+	db.SetAppliedSpec()
 	return nil
 }
 
-func deleteDatabase(ctx context.Context, db *v1alpha1.Database) error {
-	dbServer, err := getDatabaseServer(ctx, db)
+// updateUserPassword changes password of the database user if it's been changed since the last update
+func (h *Handler) updateUserPassword(ctx context.Context, db *v1alpha1.Database) (bool, error) {
+	if db.Status.Rotation != nil && db.Status.Rotation.PendingUser != "" {
+		// the output Secret may already hold the password of the pending user (the rotation is finished first)
+		return false, nil
+	}
+
+	userCredentials, err := getUserCredentials(db)
+	if err != nil {
+		return false, err
+	}
+
+	passwordHash := db.PasswordHash(userCredentials.Password)
+	if passwordHash == db.Status.PasswordHash {
+		return false, nil
+	}
+
+	dbServer, err := h.getDatabaseServer(ctx, db)
+	if err != nil {
+		return false, err
+	}
+
+	if err := dbServer.UpdateUserPassword(userCredentials); err != nil {
+		return false, err
+	}
+
+	connectionDetails := dbServer.GetConnectionDetails(db.Spec.Database.Name, userCredentials)
+	if err := updateOutputSecret(db, connectionDetails); err != nil {
+		return false, err
+	}
+
+	db.SetPasswordHash(passwordHash)
+	return true, nil
+}
+
+func (h *Handler) deleteDatabase(ctx context.Context, db *v1alpha1.Database) error {
+	dbServer, err := h.getDatabaseServer(ctx, db)
 	if err != nil {
 		return err
 	}
 
-	if err := dbServer.DeleteDatabase(db.Spec.Database.Name, db.Spec.Database.User); err != nil {
+	if err := dbServer.DeleteDatabase(appliedDatabaseName(db)); err != nil {
 		return err
 	}
+	return deleteUsers(dbServer, db)
+}
+
+// deleteUsers drops all users of the database managed by the operator (the database itself is kept)
+func (h *Handler) deleteUsers(ctx context.Context, db *v1alpha1.Database) error {
+	dbServer, err := h.getDatabaseServer(ctx, db)
+	if err != nil {
+		return err
+	}
+	return deleteUsers(dbServer, db)
+}
 
+func deleteUsers(dbServer database.DbServer, db *v1alpha1.Database) error {
+	users := managedUsers(db.Spec.Database.User, db.Spec.Rotation != nil || db.Status.Rotation != nil)
+	// spec changes might not have been applied yet
+	users = append(users, replacedUsers(db)...)
+	for _, user := range users {
+		if err := dbServer.DeleteUser(appliedDatabaseName(db), user); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func getDatabaseServer(ctx context.Context, db *v1alpha1.Database) (database.DbServer, error) {
-	// at the moment, only 'mysql' type is supported
-	if db.Spec.DatabaseServer.Type != "mysql" {
-		return nil, fmt.Errorf("unsupported database server type: %v", db.Spec.DatabaseServer.Type)
+func (h *Handler) getDatabaseServer(ctx context.Context, db *v1alpha1.Database) (database.DbServer, error) {
+	spec, err := getServerSpec(db)
+	if err != nil {
+		return nil, err
+	}
+	return h.newDatabaseServer(spec.Type, spec.Host, spec.Port, spec.SSLMode, spec.Credentials,
+		db.Spec.Database.AuthPlugin)
+}
+
+// serverSpec defines connection settings of the database server used by the resource
+type serverSpec struct {
+	Type        string
+	Host        string
+	Port        int32
+	SSLMode     string
+	Credentials *database.Credentials
+}
+
+// getServerSpec returns connection settings of the database server (either defined in the spec or referenced
+// DatabaseServer resource)
+func getServerSpec(db *v1alpha1.Database) (*serverSpec, error) {
+	if db.Spec.DatabaseServerRef != nil && db.Spec.DatabaseServer != nil {
+		return nil, &database.ValidationError{
+			Reason:  v1alpha1.ReasonInvalidSpec,
+			Message: "only one of databaseServer and databaseServerRef can be set",
+		}
+	}
+
+	if ref := db.Spec.DatabaseServerRef; ref != nil {
+		server, err := v1alpha1.GetDatabaseServer(ref.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		credentials, err := server.GetDatabaseServerCredentials()
+		if err != nil {
+			return nil, err
+		}
+
+		spec := server.Spec
+		return &serverSpec{Type: spec.Type, Host: spec.Host, Port: spec.Port, SSLMode: spec.SSLMode,
+			Credentials: credentials}, nil
+	}
+
+	if db.Spec.DatabaseServer == nil {
+		return nil, &database.ValidationError{
+			Reason:  v1alpha1.ReasonInvalidSpec,
+			Message: "either databaseServer or databaseServerRef must be set",
+		}
 	}
 
 	credentials, err := db.GetDatabaseServerCredentials()
@@ -144,10 +593,112 @@ func getDatabaseServer(ctx context.Context, db *v1alpha1.Database) (database.DbS
 		return nil, err
 	}
 
-	dbServer := &database.MySQLServer{
-		Host:        db.Spec.DatabaseServer.Host,
-		Port:        db.Spec.DatabaseServer.Port,
-		Credentials: credentials,
+	spec := db.Spec.DatabaseServer
+	return &serverSpec{Type: spec.Type, Host: spec.Host, Port: spec.Port, SSLMode: spec.SSLMode,
+		Credentials: credentials}, nil
+}
+
+// newDatabaseServer returns the database server of the given type (recording metrics of its operations and
+// limiting their concurrency)
+func (h *Handler) newDatabaseServer(serverType string, host string, port int32, sslMode string,
+	credentials *database.Credentials, authPlugin string) (database.DbServer, error) {
+	dbServer, err := newDatabaseServerOfType(serverType, host, port, sslMode, credentials, authPlugin)
+	if err != nil {
+		return nil, err
+	}
+	if !h.engineEnabled(serverType) {
+		return nil, &database.ValidationError{
+			Reason:  v1alpha1.ReasonInvalidSpec,
+			Message: fmt.Sprintf("%v database servers are disabled in the operator configuration", serverType),
+		}
+	}
+	name := fmt.Sprintf("%v:%v", host, port)
+	// time spent waiting for the free slot is not included in the operation duration
+	return h.limiter.Limit(database.NewInstrumentedServer(dbServer, name, serverType), name), nil
+}
+
+// engineEnabled checks if the database server type is enabled in the operator configuration
+func (h *Handler) engineEnabled(serverType string) bool {
+	return len(h.config.Engines) == 0 || contains(h.config.Engines, serverType)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func newDatabaseServerOfType(serverType string, host string, port int32, sslMode string,
+	credentials *database.Credentials, authPlugin string) (database.DbServer, error) {
+	switch serverType {
+	case v1alpha1.DatabaseServerTypeMySQL:
+		if sslMode != "" {
+			return nil, &database.ValidationError{
+				Reason:  v1alpha1.ReasonInvalidSpec,
+				Message: fmt.Sprintf("sslMode is not supported by %v database server", serverType),
+			}
+		}
+		return &database.MySQLServer{
+			Host:        host,
+			Port:        port,
+			Credentials: credentials,
+			AuthPlugin:  authPlugin,
+		}, nil
+	case v1alpha1.DatabaseServerTypePostgreSQL:
+		if authPlugin != "" {
+			return nil, &database.ValidationError{
+				Reason:  v1alpha1.ReasonInvalidSpec,
+				Message: fmt.Sprintf("authPlugin is not supported by %v database server", serverType),
+			}
+		}
+		if sslMode != "" && !contains(database.PostgreSQLSSLModes, sslMode) {
+			return nil, &database.ValidationError{
+				Reason: v1alpha1.ReasonInvalidSpec,
+				Message: fmt.Sprintf("unsupported sslMode: %v (must be one of %v)", sslMode,
+					strings.Join(database.PostgreSQLSSLModes, ", ")),
+			}
+		}
+		return &database.PostgreSQLServer{
+			Host:        host,
+			Port:        port,
+			Credentials: credentials,
+			SSLMode:     sslMode,
+		}, nil
+	default:
+		return nil, &database.ValidationError{
+			Reason:  v1alpha1.ReasonInvalidSpec,
+			Message: fmt.Sprintf("unsupported database server type: %v", serverType),
+		}
+	}
+}
+
+// checkDatabaseServer connects to the database server and returns the server and its version
+func (h *Handler) checkDatabaseServer(server *v1alpha1.DatabaseServer) (database.DbServer, string, error) {
+	credentials, err := server.GetDatabaseServerCredentials()
+	if err != nil {
+		return nil, "", err
+	}
+
+	dbServer, err := h.newDatabaseServer(server.Spec.Type, server.Spec.Host, server.Spec.Port, server.Spec.SSLMode,
+		credentials, "")
+	if err != nil {
+		return nil, "", err
+	}
+
+	version, err := dbServer.GetVersion()
+	if err != nil {
+		return nil, "", err
+	}
+	return dbServer, version, nil
+}
+
+// errorReason returns reason of the validation error or the given default reason for other errors
+func errorReason(err error, defaultReason string) string {
+	if validationErr, ok := err.(*database.ValidationError); ok {
+		return validationErr.Reason
 	}
-	return dbServer, nil
+	return defaultReason
 }
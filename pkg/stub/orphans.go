@@ -0,0 +1,234 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/jakub-bacic/database-k8s-operator/pkg/apis/jakub-bacic/v1alpha1"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/database"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/logging"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/metrics"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxReportedOrphans limits number of orphans listed in DatabaseServer status (all of them are counted)
+const maxReportedOrphans = 100
+
+// orphanKinds defines kinds of objects checked for orphans
+var orphanKinds = []database.ObjectKind{database.ObjectDatabase, database.ObjectUser}
+
+// serverUsage describes objects on the database server used by Database resources
+type serverUsage struct {
+	// objects referenced by the resources using the server
+	objects map[database.ServerObject]bool
+	// UIDs of all resources in the watched namespaces (objects marked by them are never orphans)
+	uids map[string]bool
+}
+
+func (usage *serverUsage) uses(object database.ServerObject) bool {
+	if usage.objects[database.ServerObject{Kind: object.Kind, Name: object.Name}] {
+		return true
+	}
+	owner, ok := v1alpha1.ParseOwnershipMarker(object.Marker)
+	return ok && usage.uids[owner.UID]
+}
+
+// updateOrphans finds databases and users on the server not used by any Database resource, drops the ones marked
+// by the operator (if the server collects orphans) and reports the remaining ones in the status
+func (h *Handler) updateOrphans(ctx context.Context, server *v1alpha1.DatabaseServer, dbServer database.DbServer) error {
+	objects, err := dbServer.ListObjects()
+	if err != nil {
+		return err
+	}
+	// resources are listed after the objects, so objects created in the meantime always have their resource listed
+	usage, err := h.getServerUsage(server)
+	if err != nil {
+		return err
+	}
+
+	var orphans []database.ServerObject
+	for _, object := range objects {
+		if !usage.uses(object) {
+			orphans = append(orphans, object)
+		}
+	}
+	if server.Spec.CollectOrphans {
+		orphans = h.collectOrphans(ctx, server, dbServer, orphans)
+	}
+
+	type orphanCount struct {
+		kind    database.ObjectKind
+		managed bool
+	}
+	counts := map[orphanCount]int{}
+	for _, orphan := range orphans {
+		_, managed := v1alpha1.ParseOwnershipMarker(orphan.Marker)
+		counts[orphanCount{kind: orphan.Kind, managed: managed}]++
+	}
+	for _, kind := range orphanKinds {
+		for _, managed := range []bool{true, false} {
+			metrics.SetOrphanedObjects(server.Name, string(kind), managed, counts[orphanCount{kind: kind, managed: managed}])
+		}
+	}
+
+	setOrphans(server, orphans)
+	return nil
+}
+
+// collectOrphans drops the orphans marked by this operator instance for the resources from the watched namespaces
+// which no longer exist, and returns the remaining ones (resources from other namespaces or handled by other
+// instances, e.g. in another cluster sharing the database server, can't be checked)
+func (h *Handler) collectOrphans(ctx context.Context, server *v1alpha1.DatabaseServer, dbServer database.DbServer,
+	orphans []database.ServerObject) []database.ServerObject {
+	logger := logging.GetLogger(ctx)
+
+	// databases are dropped first (PostgreSQL roles can't be dropped while they own a database)
+	sort.SliceStable(orphans, func(i, j int) bool {
+		return orphans[i].Kind == database.ObjectDatabase && orphans[j].Kind != database.ObjectDatabase
+	})
+
+	var remaining []database.ServerObject
+	for _, orphan := range orphans {
+		// markers set by the previous versions of the operator don't identify the instance, so they're never collected
+		owner, ok := v1alpha1.ParseOwnershipMarker(orphan.Marker)
+		if !ok || owner.InstanceID == "" || owner.InstanceID != h.config.InstanceID ||
+			!h.watchesNamespace(owner.Namespace) {
+			remaining = append(remaining, orphan)
+			continue
+		}
+		// the owner is read right before the object is dropped (it might have been created after the listing)
+		deleted, err := ownerDeleted(owner)
+		if err != nil {
+			logger.Warnf("failed to check owner of orphaned %v %v: %v", orphan.Kind, orphan.Name, err)
+			remaining = append(remaining, orphan)
+			continue
+		}
+		if !deleted {
+			// not an orphan
+			continue
+		}
+
+		if orphan.Kind == database.ObjectDatabase {
+			err = dbServer.DeleteDatabase(orphan.Name)
+		} else {
+			// the database of the user is unknown (it's usually dropped already)
+			err = dbServer.DeleteUser("", orphan.Name)
+		}
+		metrics.IncOrphansCollected(server.Name, string(orphan.Kind), err)
+		if err != nil {
+			logger.Warnf("failed to drop orphaned %v %v: %v", orphan.Kind, orphan.Name, err)
+			remaining = append(remaining, orphan)
+			continue
+		}
+		logger.Infof("Orphaned %v %v dropped (created by %v/%v)", orphan.Kind, orphan.Name, owner.Namespace,
+			owner.Name)
+	}
+	return remaining
+}
+
+// ownerDeleted checks if the resource identified by the marker has been deleted (a resource with the same name, but
+// different UID is a different one)
+func ownerDeleted(owner v1alpha1.MarkerOwner) (bool, error) {
+	db := &v1alpha1.Database{
+		TypeMeta:   metav1.TypeMeta{Kind: "Database", APIVersion: v1alpha1.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Namespace: owner.Namespace, Name: owner.Name},
+	}
+	err := sdk.Get(db)
+	if errors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get database (%v/%v): %v", owner.Namespace, owner.Name, err)
+	}
+	return string(db.UID) != owner.UID, nil
+}
+
+// getServerUsage returns objects on the database server used by the resources in the watched namespaces
+func (h *Handler) getServerUsage(server *v1alpha1.DatabaseServer) (*serverUsage, error) {
+	servers := &v1alpha1.DatabaseServerList{
+		TypeMeta: metav1.TypeMeta{Kind: "DatabaseServer", APIVersion: v1alpha1.SchemeGroupVersion.String()},
+	}
+	if err := sdk.List("", servers); err != nil {
+		return nil, fmt.Errorf("failed to list database servers: %v", err)
+	}
+	// several DatabaseServer resources may point to the same server
+	sameServer := map[string]bool{}
+	for _, other := range servers.Items {
+		if other.Spec.Host == server.Spec.Host && other.Spec.Port == server.Spec.Port {
+			sameServer[other.Name] = true
+		}
+	}
+
+	usage := &serverUsage{objects: map[database.ServerObject]bool{}, uids: map[string]bool{}}
+	for _, namespace := range h.config.Namespaces {
+		databases := &v1alpha1.DatabaseList{
+			TypeMeta: metav1.TypeMeta{Kind: "Database", APIVersion: v1alpha1.SchemeGroupVersion.String()},
+		}
+		if err := sdk.List(namespace, databases); err != nil {
+			return nil, fmt.Errorf("failed to list databases: %v", err)
+		}
+
+		for i := range databases.Items {
+			db := &databases.Items[i]
+			usage.uids[string(db.UID)] = true
+
+			if ref := db.Spec.DatabaseServerRef; ref != nil && !sameServer[ref.Name] {
+				continue
+			}
+			if spec := db.Spec.DatabaseServer; spec != nil &&
+				(spec.Host != server.Spec.Host || spec.Port != server.Spec.Port) {
+				continue
+			}
+			for _, object := range databaseObjects(db) {
+				usage.objects[object] = true
+			}
+			for _, user := range managedUsers(db.Spec.Database.User, true) {
+				usage.objects[userObject(user)] = true
+			}
+			// spec changes might not have been applied yet
+			if applied := db.Status.AppliedSpec; applied != nil {
+				usage.objects[database.ServerObject{Kind: database.ObjectDatabase, Name: applied.DatabaseName}] = true
+				for _, user := range managedUsers(applied.User, true) {
+					usage.objects[userObject(user)] = true
+				}
+			}
+		}
+	}
+	return usage, nil
+}
+
+// watchesNamespace checks if the resources in the namespace are watched by the operator
+func (h *Handler) watchesNamespace(namespace string) bool {
+	for _, watched := range h.config.Namespaces {
+		if watched == metav1.NamespaceAll || watched == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// setOrphans updates orphans in the status (sorted by kind and name, so the status doesn't change between checks)
+func setOrphans(server *v1alpha1.DatabaseServer, orphans []database.ServerObject) {
+	sort.Slice(orphans, func(i, j int) bool {
+		if orphans[i].Kind != orphans[j].Kind {
+			return orphans[i].Kind < orphans[j].Kind
+		}
+		return orphans[i].Name < orphans[j].Name
+	})
+
+	server.Status.Orphans = nil
+	server.Status.OrphanCount = int32(len(orphans))
+	for i, orphan := range orphans {
+		if i == maxReportedOrphans {
+			break
+		}
+		reported := v1alpha1.OrphanObject{Kind: string(orphan.Kind), Name: orphan.Name}
+		if owner, ok := v1alpha1.ParseOwnershipMarker(orphan.Marker); ok {
+			reported.Owner = owner.Namespace + "/" + owner.Name
+		}
+		server.Status.Orphans = append(server.Status.Orphans, reported)
+	}
+}
@@ -0,0 +1,217 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jakub-bacic/database-k8s-operator/pkg/apis/jakub-bacic/v1alpha1"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/database"
+	"k8s.io/api/core/v1"
+)
+
+// validateAdoptionPolicy checks if the adoption policy is supported
+func validateAdoptionPolicy(db *v1alpha1.Database) error {
+	switch policy := db.AdoptionPolicy(); policy {
+	case v1alpha1.AdoptionPolicyFail, v1alpha1.AdoptionPolicyAdopt, v1alpha1.AdoptionPolicyAdoptAndRetain:
+		return nil
+	default:
+		return &database.ValidationError{
+			Reason: v1alpha1.ReasonInvalidSpec,
+			Message: fmt.Sprintf("unsupported adoptionPolicy: %v (must be one of Fail, Adopt, AdoptAndRetain)",
+				policy),
+		}
+	}
+}
+
+// checkOwnership checks if the objects to be created either don't exist or are managed by the resource. Existing
+// objects not marked by the resource are adopted only if the adoption policy allows it and they're not managed by
+// another existing resource. Missing objects are recorded as pending in the status (saved right away), so they're not
+// considered foreign if the creation fails halfway.
+func (h *Handler) checkOwnership(ctx context.Context, db *v1alpha1.Database, dbServer database.DbServer,
+	objects ...database.ServerObject) error {
+	if err := validateAdoptionPolicy(db); err != nil {
+		return err
+	}
+
+	var missing []database.ServerObject
+	for _, object := range objects {
+		exists, marker, err := dbServer.GetOwnershipMarker(object.Kind, object.Name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			missing = append(missing, object)
+			continue
+		}
+		if ownsMarker(db, marker) || appliedObject(db, object) || pendingObject(db, object) {
+			continue
+		}
+
+		policy := db.AdoptionPolicy()
+		if policy == v1alpha1.AdoptionPolicyFail {
+			owner := "is not managed by the resource"
+			if marker != "" {
+				owner = fmt.Sprintf("is managed by %v", marker)
+			}
+			return &database.ValidationError{
+				Reason: v1alpha1.ReasonAlreadyExists,
+				Message: fmt.Sprintf("%v %v already exists on %v and %v (set adoptionPolicy to adopt it)", object.Kind,
+					object.Name, db.DatabaseServerName(), owner),
+			}
+		}
+		// objects managed by other existing resources are never taken over (both of them would manage the object)
+		if owner, ok := v1alpha1.ParseOwnershipMarker(marker); ok {
+			live, err := h.ownerExists(owner)
+			if err != nil {
+				return err
+			}
+			if live {
+				return &database.ValidationError{
+					Reason: v1alpha1.ReasonAlreadyExists,
+					Message: fmt.Sprintf("%v %v already exists on %v and is managed by %v/%v (only objects of deleted "+
+						"resources can be adopted)", object.Kind, object.Name, db.DatabaseServerName(), owner.Namespace,
+						owner.Name),
+				}
+			}
+		}
+		h.recordEvent(ctx, db, v1.EventTypeNormal, eventReasonAdopted, "Adopting existing %v %v (adoptionPolicy: %v)",
+			object.Kind, object.Name, policy)
+		db.Status.Adopted = true
+	}
+	return setPendingObjects(db, missing...)
+}
+
+// ownerExists checks if the resource identified by the marker still exists. Resources handled by other operator
+// instances (e.g. in another cluster) can't be checked, so they're assumed to exist.
+func (h *Handler) ownerExists(owner v1alpha1.MarkerOwner) (bool, error) {
+	if owner.InstanceID != "" && owner.InstanceID != h.config.InstanceID {
+		return true, nil
+	}
+	deleted, err := ownerDeleted(owner)
+	return !deleted, err
+}
+
+// setPendingObjects records the objects as pending and saves the status if any of them is new
+func setPendingObjects(db *v1alpha1.Database, objects ...database.ServerObject) error {
+	changed := false
+	for _, object := range objects {
+		if !pendingObject(db, object) {
+			db.Status.PendingObjects = append(db.Status.PendingObjects,
+				v1alpha1.PendingObject{Kind: string(object.Kind), Name: object.Name})
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if err := updateStatus(db, "databases", db.Namespace); err != nil {
+		return fmt.Errorf("failed to save pending objects: %v", err)
+	}
+	return nil
+}
+
+// ownsMarker checks if the ownership marker identifies the resource
+func ownsMarker(db *v1alpha1.Database, marker string) bool {
+	owner, ok := v1alpha1.ParseOwnershipMarker(marker)
+	return ok && owner.Owns(db)
+}
+
+// pendingObject checks if the object is being created by the resource
+func pendingObject(db *v1alpha1.Database, object database.ServerObject) bool {
+	for _, pending := range db.Status.PendingObjects {
+		if pending.Kind == string(object.Kind) && pending.Name == object.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// markOwnership marks the objects as managed by the resource. Pending objects are cleared only once the whole
+// creation succeeds (see createdAnything).
+func (h *Handler) markOwnership(db *v1alpha1.Database, dbServer database.DbServer,
+	objects ...database.ServerObject) error {
+	marker := db.OwnershipMarker(h.config.InstanceID)
+	for _, object := range objects {
+		if err := dbServer.SetOwnershipMarker(object.Kind, object.Name, marker); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseOwnership removes ownership markers of the objects retained after the resource is deleted, so they're never
+// collected as orphans. Any failure is returned, so the deletion (and removal of the finalizer) is retried - the
+// server might collect orphans later (or be matched by a DatabaseServer collecting them).
+func (h *Handler) releaseOwnership(ctx context.Context, db *v1alpha1.Database, objects ...database.ServerObject) error {
+	dbServer, err := h.getDatabaseServer(ctx, db)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		exists, marker, err := dbServer.GetOwnershipMarker(object.Kind, object.Name)
+		if err != nil {
+			return err
+		}
+		if !exists || !ownsMarker(db, marker) {
+			continue
+		}
+		if err := dbServer.SetOwnershipMarker(object.Kind, object.Name, ""); err != nil {
+			return err
+		}
+
+		// the marker must be gone before the finalizer is removed
+		exists, marker, err = dbServer.GetOwnershipMarker(object.Kind, object.Name)
+		if err != nil {
+			return err
+		}
+		if exists && ownsMarker(db, marker) {
+			return fmt.Errorf("ownership marker of %v %v has not been removed", object.Kind, object.Name)
+		}
+	}
+	return nil
+}
+
+// retainedObjects returns the database and all its users which may exist on the server (users are dropped by
+// RetainData deletion policy, so only the database is retained then)
+func retainedObjects(db *v1alpha1.Database, users bool) []database.ServerObject {
+	objects := []database.ServerObject{{Kind: database.ObjectDatabase, Name: appliedDatabaseName(db)}}
+	if !users {
+		return objects
+	}
+	names := managedUsers(db.Spec.Database.User, db.Spec.Rotation != nil || db.Status.Rotation != nil)
+	for _, user := range append(names, replacedUsers(db)...) {
+		objects = append(objects, userObject(user))
+	}
+	return objects
+}
+
+// appliedObject checks if the object has been created for the applied spec (objects created by the previous
+// versions of the operator are not marked)
+func appliedObject(db *v1alpha1.Database, object database.ServerObject) bool {
+	applied := db.Status.AppliedSpec
+	if applied == nil || applied.DatabaseServer != db.DatabaseServerID() {
+		return false
+	}
+	if object.Kind == database.ObjectDatabase {
+		return applied.DatabaseName == object.Name
+	}
+	for _, user := range managedUsers(applied.User, applied.Rotation) {
+		if user == object.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// databaseObjects returns the database and its owner (the owner role is created together with the database by
+// the engines supporting database ownership)
+func databaseObjects(db *v1alpha1.Database) []database.ServerObject {
+	return []database.ServerObject{
+		{Kind: database.ObjectDatabase, Name: db.Spec.Database.Name},
+		{Kind: database.ObjectUser, Name: db.Spec.Database.User},
+	}
+}
+
+func userObject(user string) database.ServerObject {
+	return database.ServerObject{Kind: database.ObjectUser, Name: user}
+}
@@ -0,0 +1,144 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jakub-bacic/database-k8s-operator/pkg/apis/jakub-bacic/v1alpha1"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/database"
+)
+
+// validateRotation checks if the rotation policy can be applied to the resource
+func validateRotation(db *v1alpha1.Database) error {
+	if db.Spec.Rotation == nil {
+		return nil
+	}
+	if !db.GeneratedPassword() {
+		return &database.ValidationError{
+			Reason:  v1alpha1.ReasonInvalidSpec,
+			Message: "rotation requires generated passwords (passwordSecretRef can't be set)",
+		}
+	}
+	if _, _, err := db.GetRotationPolicy(); err != nil {
+		return &database.ValidationError{Reason: v1alpha1.ReasonInvalidSpec, Message: err.Error()}
+	}
+	return nil
+}
+
+// rotateCredentials drops the previous user after the grace period and activates new credentials when the rotation
+// interval passes. It returns true if the resource status has been changed.
+//
+// The new user is saved in the status before the output Secret is switched to it, so an interrupted rotation is
+// finished with the same user and password once the Secret has been updated (or restarted otherwise).
+func (h *Handler) rotateCredentials(ctx context.Context, db *v1alpha1.Database) (bool, error) {
+	if db.Spec.Rotation == nil {
+		return false, nil
+	}
+	if err := validateRotation(db); err != nil {
+		return false, err
+	}
+	interval, gracePeriod, _ := db.GetRotationPolicy()
+
+	rotation := db.Status.Rotation
+	var sinceLastRotation time.Duration
+	if rotation != nil {
+		sinceLastRotation = time.Since(time.Unix(rotation.LastRotationTimestamp, 0))
+	}
+
+	if rotation != nil && rotation.PendingUser != "" {
+		published, err := pendingUserPublished(db)
+		if err != nil {
+			return false, err
+		}
+		if published {
+			completeRotation(db)
+			return true, nil
+		}
+	} else if rotation != nil && rotation.PreviousUser != "" {
+		// next rotation can't start before the previous user is dropped
+		if sinceLastRotation < gracePeriod {
+			return false, nil
+		}
+		dbServer, err := h.getDatabaseServer(ctx, db)
+		if err != nil {
+			return false, err
+		}
+		if err := dbServer.DeleteUser(db.Spec.Database.Name, rotation.PreviousUser); err != nil {
+			return false, err
+		}
+		rotation.PreviousUser = ""
+		return true, nil
+	} else if rotation != nil && sinceLastRotation < interval {
+		return false, nil
+	}
+
+	dbServer, err := h.getDatabaseServer(ctx, db)
+	if err != nil {
+		return false, err
+	}
+
+	password, err := database.GeneratePassword(generatedPasswordLength)
+	if err != nil {
+		return false, err
+	}
+	// the pending user isn't published yet, so its password can be changed if the rotation is restarted
+	userCredentials := &database.Credentials{User: nextRotationUser(db), Password: password}
+	if err := h.checkOwnership(ctx, db, dbServer, userObject(userCredentials.User)); err != nil {
+		return false, err
+	}
+	if err := dbServer.CreateUser(db.Spec.Database.Name, db.Spec.Database.User, userCredentials); err != nil {
+		return false, err
+	}
+	if err := h.markOwnership(db, dbServer, userObject(userCredentials.User)); err != nil {
+		return false, err
+	}
+
+	if db.Status.Rotation == nil {
+		db.Status.Rotation = &v1alpha1.RotationStatus{}
+	}
+	db.Status.Rotation.PendingUser = userCredentials.User
+	db.Status.Rotation.PendingPasswordHash = db.PasswordHash(password)
+	if err := updateStatus(db, "databases", db.Namespace); err != nil {
+		return false, fmt.Errorf("failed to save rotation status: %v", err)
+	}
+
+	connectionDetails := dbServer.GetConnectionDetails(db.Spec.Database.Name, userCredentials)
+	if err := updateOutputSecret(db, connectionDetails); err != nil {
+		return false, err
+	}
+
+	completeRotation(db)
+	return true, nil
+}
+
+// pendingUserPublished checks if the output Secret already holds the password of the pending rotation user
+func pendingUserPublished(db *v1alpha1.Database) (bool, error) {
+	secret, err := getOutputSecret(db)
+	if err != nil || secret == nil {
+		return false, err
+	}
+	password, ok := secret.Data[outputSecretPasswordKey]
+	return ok && len(password) > 0 && db.PasswordHash(string(password)) == db.Status.Rotation.PendingPasswordHash, nil
+}
+
+// completeRotation activates the pending user published in the output Secret
+func completeRotation(db *v1alpha1.Database) {
+	rotation := db.Status.Rotation
+	db.Status.Rotation = &v1alpha1.RotationStatus{
+		ActiveUser:            rotation.PendingUser,
+		PreviousUser:          rotation.ActiveUser,
+		LastRotationTimestamp: time.Now().Unix(),
+	}
+	db.SetPasswordHash(rotation.PendingPasswordHash)
+	db.Status.PendingObjects = nil
+}
+
+// nextRotationUser returns the user to be activated during the next rotation
+func nextRotationUser(db *v1alpha1.Database) string {
+	userA, userB := db.RotationUsers()
+	if db.Status.Rotation != nil && db.Status.Rotation.ActiveUser == userA {
+		return userB
+	}
+	return userA
+}
@@ -0,0 +1,268 @@
+package stub
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"text/template"
+
+	"github.com/jakub-bacic/database-k8s-operator/pkg/apis/jakub-bacic/v1alpha1"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/database"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// generatedPasswordLength defines length of the passwords generated by the operator
+const generatedPasswordLength = 32
+
+// outputSecretPasswordKey is the key holding generated password (it's always present in the output Secret when
+// the password is generated, so it can be read back)
+const outputSecretPasswordKey = "password"
+
+// defaultOutputSecretKeys defines keys of the output Secret when they're not configured by the user
+var defaultOutputSecretKeys = map[string]string{
+	"user":                  "{{ .User }}",
+	outputSecretPasswordKey: "{{ .Password }}",
+	"host":                  "{{ .Host }}",
+	"port":                  "{{ .Port }}",
+	"database":              "{{ .Database }}",
+	"dsn":                   "{{ .DSN }}",
+	"uri":                   "{{ .URI }}",
+	"jdbcUrl":               "{{ .JDBCURL }}",
+}
+
+// handleSecret handles created Databases using the changed Secret, so changes (e.g. of the user password) are applied
+// without waiting for the resync
+func (h *Handler) handleSecret(ctx context.Context, secret *v1.Secret) error {
+	databases := &v1alpha1.DatabaseList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Database",
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		},
+	}
+	if err := sdk.List(secret.Namespace, databases); err != nil {
+		return fmt.Errorf("failed to list databases: %v", err)
+	}
+
+	for i := range databases.Items {
+		db := &databases.Items[i]
+		if db.Status.Status != v1alpha1.StatusCreated || !usesSecret(db, secret.Name) {
+			continue
+		}
+		db.Kind = "Database"
+		db.APIVersion = v1alpha1.SchemeGroupVersion.String()
+		if err := h.handleDatabase(ctx, db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// usesSecret checks if the Secret with the given name (in the resource namespace) is used by the resource
+func usesSecret(db *v1alpha1.Database, name string) bool {
+	if ref := db.Spec.Database.PasswordSecretRef; ref != nil && ref.Name == name {
+		return true
+	}
+	if outputSecret := db.Spec.OutputSecret; outputSecret != nil && outputSecret.Name == name {
+		return true
+	}
+	if server := db.Spec.DatabaseServer; server != nil && server.RootPasswordSecretRef.Name == name {
+		return true
+	}
+	return false
+}
+
+// getUserCredentials returns credentials of the database user. If the password is generated by the operator, it's
+// read from the output Secret (new password is generated if the Secret doesn't exist yet).
+func getUserCredentials(db *v1alpha1.Database) (*database.Credentials, error) {
+	if !db.GeneratedPassword() {
+		return db.GetDatabaseUserCredentials()
+	}
+
+	secret, err := getOutputSecret(db)
+	if err != nil {
+		return nil, err
+	}
+	previous := db.Status.OutputSecretName
+	if secret == nil && previous != "" && previous != db.Spec.OutputSecret.Name {
+		// outputSecret has been renamed, the password is moved to the new Secret
+		secret, err = getOwnedSecret(db, previous)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if secret != nil {
+		if password, ok := secret.Data[outputSecretPasswordKey]; ok && len(password) > 0 {
+			return &database.Credentials{User: db.ActiveUser(), Password: string(password)}, nil
+		}
+	}
+
+	password, err := database.GeneratePassword(generatedPasswordLength)
+	if err != nil {
+		return nil, err
+	}
+	return &database.Credentials{User: db.ActiveUser(), Password: password}, nil
+}
+
+// reconcileOutputSecret makes sure the output Secret matches the spec (e.g. after its name or keys have been changed
+// or it has been deleted)
+func (h *Handler) reconcileOutputSecret(ctx context.Context, db *v1alpha1.Database) error {
+	if db.Spec.OutputSecret == nil {
+		return deletePreviousOutputSecret(db)
+	}
+
+	userCredentials, err := getUserCredentials(db)
+	if err != nil {
+		return err
+	}
+	if db.PasswordHash(userCredentials.Password) != db.Status.PasswordHash {
+		// the password is not set on the server yet, it's published once it's updated
+		return nil
+	}
+
+	dbServer, err := h.getDatabaseServer(ctx, db)
+	if err != nil {
+		return err
+	}
+	return updateOutputSecret(db, dbServer.GetConnectionDetails(db.Spec.Database.Name, userCredentials))
+}
+
+// updateOutputSecret creates or updates the output Secret with the database connection details (the Secret
+// previously written by the operator is deleted if it has been renamed)
+func updateOutputSecret(db *v1alpha1.Database, connectionDetails *database.ConnectionDetails) error {
+	if db.Spec.OutputSecret == nil {
+		return deletePreviousOutputSecret(db)
+	}
+
+	data, err := renderOutputSecretData(db, connectionDetails)
+	if err != nil {
+		return err
+	}
+
+	secret, err := getOutputSecret(db)
+	if err != nil {
+		return err
+	}
+
+	if secret == nil {
+		secret = newSecret(db.Namespace, db.Spec.OutputSecret.Name)
+		secret.OwnerReferences = []metav1.OwnerReference{
+			*metav1.NewControllerRef(db, v1alpha1.SchemeGroupVersion.WithKind("Database")),
+		}
+		secret.Data = data
+		if err := sdk.Create(secret); err != nil {
+			return fmt.Errorf("failed to create secret (%v/%v): %v", secret.Namespace, secret.Name, err)
+		}
+	} else if !reflect.DeepEqual(secret.Data, data) {
+		secret.Data = data
+		if err := sdk.Update(secret); err != nil {
+			return fmt.Errorf("failed to update secret (%v/%v): %v", secret.Namespace, secret.Name, err)
+		}
+	}
+
+	if err := deletePreviousOutputSecret(db); err != nil {
+		return err
+	}
+	db.Status.OutputSecretName = secret.Name
+	return nil
+}
+
+// deletePreviousOutputSecret deletes the output Secret previously written by the operator if it's no longer used
+func deletePreviousOutputSecret(db *v1alpha1.Database) error {
+	previous := db.Status.OutputSecretName
+	if previous == "" || db.Spec.OutputSecret != nil && db.Spec.OutputSecret.Name == previous {
+		return nil
+	}
+
+	secret := newSecret(db.Namespace, previous)
+	if err := sdk.Get(secret); err != nil && !errors.IsNotFound(err) {
+		return &v1alpha1.SecretError{
+			Message: fmt.Sprintf("failed to get secret (%v/%v): %v", secret.Namespace, secret.Name, err),
+		}
+	} else if err == nil && metav1.IsControlledBy(secret, db) {
+		if err := sdk.Delete(secret); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete secret (%v/%v): %v", secret.Namespace, secret.Name, err)
+		}
+	}
+	db.Status.OutputSecretName = ""
+	return nil
+}
+
+// renderOutputSecretData returns data of the output Secret rendered from the configured key templates
+func renderOutputSecretData(db *v1alpha1.Database, connectionDetails *database.ConnectionDetails) (map[string][]byte,
+	error) {
+	keys := db.Spec.OutputSecret.Keys
+	if len(keys) == 0 {
+		keys = defaultOutputSecretKeys
+	}
+
+	data := map[string][]byte{}
+	for key, value := range keys {
+		tmpl, err := template.New(key).Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, &database.ValidationError{
+				Reason:  v1alpha1.ReasonInvalidSpec,
+				Message: fmt.Sprintf("invalid template of output secret key %v: %v", key, err),
+			}
+		}
+
+		var buffer bytes.Buffer
+		if err := tmpl.Execute(&buffer, connectionDetails); err != nil {
+			return nil, &database.ValidationError{
+				Reason:  v1alpha1.ReasonInvalidSpec,
+				Message: fmt.Sprintf("invalid template of output secret key %v: %v", key, err),
+			}
+		}
+		data[key] = buffer.Bytes()
+	}
+
+	if db.GeneratedPassword() {
+		data[outputSecretPasswordKey] = []byte(connectionDetails.Password)
+	}
+	return data, nil
+}
+
+// getOutputSecret returns the output Secret or nil if it doesn't exist (Secrets not owned by the resource are
+// never used)
+func getOutputSecret(db *v1alpha1.Database) (*v1.Secret, error) {
+	if db.Spec.OutputSecret == nil {
+		return nil, fmt.Errorf("outputSecret is not set")
+	}
+	return getOwnedSecret(db, db.Spec.OutputSecret.Name)
+}
+
+// getOwnedSecret returns the Secret owned by the resource or nil if it doesn't exist
+func getOwnedSecret(db *v1alpha1.Database, name string) (*v1.Secret, error) {
+	secret := newSecret(db.Namespace, name)
+	if err := sdk.Get(secret); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, &v1alpha1.SecretError{
+			Message: fmt.Sprintf("failed to get secret (%v/%v): %v", secret.Namespace, secret.Name, err),
+		}
+	}
+	if !metav1.IsControlledBy(secret, db) {
+		return nil, &v1alpha1.SecretError{
+			Message: fmt.Sprintf("secret (%v/%v) already exists and is not owned by the resource", secret.Namespace,
+				secret.Name),
+		}
+	}
+	return secret, nil
+}
+
+func newSecret(namespace string, name string) *v1.Secret {
+	return &v1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+}
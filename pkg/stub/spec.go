@@ -0,0 +1,99 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jakub-bacic/database-k8s-operator/pkg/apis/jakub-bacic/v1alpha1"
+	"github.com/jakub-bacic/database-k8s-operator/pkg/database"
+)
+
+// applySpecChanges applies changes of the spec made after the database has been created. It returns true if the
+// resource status has been changed.
+func (h *Handler) applySpecChanges(ctx context.Context, db *v1alpha1.Database) (bool, error) {
+	if db.Status.AppliedSpec == nil {
+		// database created before the applied spec was tracked
+		db.SetAppliedSpec()
+		return true, nil
+	}
+
+	if *db.Status.AppliedSpec == *db.CurrentAppliedSpec() {
+		// nothing to apply (e.g. only the rotation policy changed), the generation is recorded with the status update
+		// at the end of the reconciliation
+		db.Status.ObservedGeneration = db.Generation
+		return false, nil
+	}
+
+	// database creation is idempotent, it also removes users which are no longer used
+	if err := h.createDatabase(ctx, db); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// appliedDatabaseName returns name of the database created on the server (the name change might have been
+// rejected, see validateSpecChanges)
+func appliedDatabaseName(db *v1alpha1.Database) string {
+	if applied := db.Status.AppliedSpec; applied != nil {
+		return applied.DatabaseName
+	}
+	return db.Spec.Database.Name
+}
+
+// createdAnything checks if the resource might have created (or adopted) any object on the database server
+func createdAnything(db *v1alpha1.Database) bool {
+	return db.Status.AppliedSpec != nil || len(db.Status.PendingObjects) > 0 || db.Status.Adopted
+}
+
+// validateSpecChanges rejects changes of the spec which can't be applied to the existing database
+func validateSpecChanges(db *v1alpha1.Database) error {
+	applied := db.Status.AppliedSpec
+	if applied == nil {
+		return nil
+	}
+
+	if applied.DatabaseName != db.Spec.Database.Name {
+		return &database.ValidationError{
+			Reason: v1alpha1.ReasonInvalidSpec,
+			Message: fmt.Sprintf("database name can't be changed after creation (current name: %v)",
+				applied.DatabaseName),
+		}
+	}
+	if applied.DatabaseServer != db.DatabaseServerID() {
+		return &database.ValidationError{
+			Reason: v1alpha1.ReasonInvalidSpec,
+			Message: fmt.Sprintf("database server can't be changed after creation (current server: %v)",
+				applied.DatabaseServer),
+		}
+	}
+	return nil
+}
+
+// replacedUsers returns users created for the applied spec which are not used by the current spec
+func replacedUsers(db *v1alpha1.Database) []string {
+	applied := db.Status.AppliedSpec
+	if applied == nil {
+		return nil
+	}
+
+	current := map[string]bool{}
+	for _, user := range managedUsers(db.Spec.Database.User, db.Spec.Rotation != nil) {
+		current[user] = true
+	}
+
+	var users []string
+	for _, user := range managedUsers(applied.User, applied.Rotation) {
+		if !current[user] {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+// managedUsers returns all users which may be created for the given database user
+func managedUsers(user string, rotation bool) []string {
+	if !rotation {
+		return []string{user}
+	}
+	return []string{user, user + "_a", user + "_b"}
+}
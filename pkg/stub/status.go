@@ -0,0 +1,91 @@
+package stub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/jakub-bacic/database-k8s-operator/pkg/apis/jakub-bacic/v1alpha1"
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/operator-framework/operator-sdk/pkg/util/k8sutil"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	statusClient     dynamic.Interface
+	statusClientErr  error
+	statusClientOnce sync.Once
+)
+
+// updateDatabase saves changes of the resource (original is the resource before the changes). Metadata and spec are
+// saved using the regular update, status using the status subresource.
+func updateDatabase(original *v1alpha1.Database, db *v1alpha1.Database) error {
+	status := db.Status
+	if !equalJSON(original.ObjectMeta, db.ObjectMeta) || !equalJSON(original.Spec, db.Spec) {
+		if err := sdk.Update(db); err != nil {
+			return err
+		}
+		// the update returns status stored on the server (decoded into the local one, so it can't tell if the status
+		// has been saved as well); updateStatus falls back to the regular update without the status subresource
+		db.Status = status
+	}
+
+	if equalJSON(original.Status, status) {
+		return nil
+	}
+	return updateStatus(db, "databases", db.Namespace)
+}
+
+// updateDatabaseServer saves status changes of the resource (original is the resource before the changes)
+func updateDatabaseServer(original *v1alpha1.DatabaseServer, server *v1alpha1.DatabaseServer) error {
+	if equalJSON(original.Status, server.Status) {
+		return nil
+	}
+	return updateStatus(server, "databaseservers", "")
+}
+
+// equalJSON checks if JSON representations of the objects are equal (timestamps decoded from the server have
+// lower precision, so they're not equal to the local ones otherwise)
+func equalJSON(a interface{}, b interface{}) bool {
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && bytes.Equal(aJSON, bJSON)
+}
+
+// updateStatus saves status of the resource using the status subresource. The regular update is used if the
+// subresource is not enabled (e.g. CustomResourceSubresources feature gate is disabled in Kubernetes 1.10).
+func updateStatus(object sdk.Object, resource string, namespace string) error {
+	statusClientOnce.Do(func() {
+		config := *k8sclient.GetKubeConfig()
+		config.GroupVersion = &v1alpha1.SchemeGroupVersion
+		config.APIPath = "/apis"
+		statusClient, statusClientErr = dynamic.NewClient(&config)
+	})
+	if statusClientErr != nil {
+		return fmt.Errorf("failed to create status client: %v", statusClientErr)
+	}
+
+	unstructuredObject, err := k8sutil.UnstructuredFromRuntimeObject(object)
+	if err != nil {
+		return err
+	}
+
+	kind := object.GetObjectKind().GroupVersionKind().Kind
+	resourceClient := statusClient.Resource(&metav1.APIResource{
+		Name:       resource + "/status",
+		Namespaced: namespace != "",
+		Kind:       kind,
+	}, namespace)
+	result, err := resourceClient.Update(unstructuredObject)
+	if errors.IsNotFound(err) {
+		return sdk.Update(object)
+	}
+	if err != nil {
+		return err
+	}
+	return k8sutil.UnstructuredIntoRuntimeObject(result, object)
+}